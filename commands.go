@@ -0,0 +1,555 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"tg-gifts-parser/external"
+	"tg-gifts-parser/internal"
+	"tg-gifts-parser/internal/config"
+	"tg-gifts-parser/internal/parser"
+	"tg-gifts-parser/internal/progress"
+	"tg-gifts-parser/internal/storage"
+	"tg-gifts-parser/internal/tui"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// command is one subcommand. run defines its flags on fs, parses args with
+// parseFlags and returns the process exit code.
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(ctx context.Context, cfg config.Config, fs *flag.FlagSet, args []string) int
+}
+
+var commands = []command{
+	{"tui", "", "Browse gift combinations interactively (the default)", runTUI},
+	{"pull", "[-tui]", "Fetch the latest databases from the repository with git", runPull},
+	{"scrape", "[gift...]", "Scrape every number not yet stored, for all or the named collections", runScrape},
+	{"update", "[-commit]", "Scrape numbers issued since the last run", runUpdate},
+	{"daemon", "", "Run update on the configured interval, committing past the threshold", runDaemon},
+	{"query", "[-gift name]... [flags] [gift...]", "List stored gifts matching model, backdrop, symbol, owner or number", runQuery},
+	{"stats", "[gift...]", "Show stored rows, gaps and mint progress per collection", runStats},
+	{"export", "[-format f] [-columns a,b] [-o file] [gift...]", "Write stored gifts as CSV, NDJSON or SQLite", runExport},
+	{"verify", "", "Check the databases for damage", runVerify},
+	{"serve", "[-addr addr]", "Serve a read-only JSON API over the databases", runServe},
+	{"repair", "", "Re-fetch missing, duplicated or failed numbers", runRepair},
+	{"refresh", "[-strategy s] [-sample n]", "Re-scan stored items for owner and attribute changes", runRefresh},
+	{"reparse", "[dir]", "Rebuild databases from archived pages without network access", runReparse},
+	{"coordinator", "[addr]", "Hand out number ranges to workers on other machines", runCoordinator},
+	{"worker", "<coordinator URL> [slots]", "Scrape ranges leased from a coordinator", runWorker},
+	{"migrate", "", "Rewrite existing databases with the current schema", runMigrate},
+	{"convert", "[-to backend]", "Copy the databases into the other storage backend", runConvert},
+	{"discover", "[-apply] [candidate...]", "Probe the given candidate names and optionally add the ones that exist to the catalog", runDiscover},
+	{"catalog", "rebuild [-dry-run]", "Rewrite gifts.json models and base.json from the databases", runCatalog},
+}
+
+// legacyModes maps the old --update and --external arguments to the commands
+// and flags that replaced them, so existing scripts keep working. --update
+// pulled and then opened the TUI, which is what pull -tui does.
+var legacyModes = map[string][]string{
+	"--update":   {"pull", "-tui"},
+	"--external": {"daemon"},
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+func (cmd command) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "Usage: tg-gifts-parser [config flags] %s %s\n\n%s.\n", cmd.name, cmd.args, cmd.summary)
+		hasFlags := false
+		fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintln(out, "\nFlags:")
+			fs.PrintDefaults()
+		}
+	}
+	return fs
+}
+
+// parseFlags parses args into fs. When it returns false the command should
+// exit with the returned code: 0 after -h, 2 after a bad flag.
+func parseFlags(fs *flag.FlagSet, args []string) (int, bool) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK, false
+		}
+		return exitUsage, false
+	}
+	return exitOK, true
+}
+
+// parseArgs is parseFlags for commands that take at most max positional
+// arguments; any more are a usage error.
+func parseArgs(fs *flag.FlagSet, args []string, max int) (int, bool) {
+	if code, ok := parseFlags(fs, args); !ok {
+		return code, false
+	}
+	if fs.NArg() > max {
+		return usageError(fs, "unexpected argument %q", fs.Arg(max)), false
+	}
+	return exitOK, true
+}
+
+func usageError(fs *flag.FlagSet, format string, a ...any) int {
+	fmt.Fprintf(fs.Output(), format+"\n\n", a...)
+	fs.Usage()
+	return exitUsage
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: tg-gifts-parser [config flags] <command> [flags] [args]")
+	fmt.Fprintln(w, "\nCommands:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	tw.Flush()
+	fmt.Fprintln(w, "\nRun 'tg-gifts-parser help <command>' for the flags of a command.")
+	fmt.Fprintln(w, "\nExit codes: 0 success, 1 failure, 2 usage error, 3 problems found, 130 interrupted.")
+	fmt.Fprintln(w, "The old --update and --external arguments still run 'pull -tui' and 'daemon'.")
+	fmt.Fprintln(w, "\nConfig flags:")
+	config.PrintFlags(w)
+}
+
+func helpCommand(args []string) int {
+	if len(args) == 0 {
+		printUsage(os.Stdout)
+		return exitOK
+	}
+	cmd, ok := findCommand(args[0])
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", args[0])
+		printUsage(os.Stderr)
+		return exitUsage
+	}
+	fs := cmd.flagSet()
+	fs.SetOutput(os.Stdout)
+	return cmd.run(context.Background(), config.Default(), fs, []string{"-h"})
+}
+
+func runTUI(ctx context.Context, cfg config.Config, fs *flag.FlagSet, args []string) int {
+	if code, ok := parseArgs(fs, args, 0); !ok {
+		return code
+	}
+
+	internal.ClearScreen()
+	prog := tea.NewProgram(tui.InitialModel(), tea.WithContext(ctx))
+	if _, err := prog.Run(); err != nil && !errors.Is(err, tea.ErrProgramKilled) {
+		fmt.Fprintln(os.Stderr, "TUI exited with error:", err)
+		return exitFailed
+	}
+	return exitOK
+}
+
+func runPull(ctx context.Context, cfg config.Config, fs *flag.FlagSet, args []string) int {
+	openTUI := fs.Bool("tui", false, "open the TUI once the databases are pulled")
+	if code, ok := parseArgs(fs, args, 0); !ok {
+		return code
+	}
+	if err := internal.UpdateAll(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+	if *openTUI {
+		return runTUI(ctx, cfg, flag.NewFlagSet("tui", flag.ContinueOnError), nil)
+	}
+	return exitOK
+}
+
+func runScrape(ctx context.Context, cfg config.Config, fs *flag.FlagSet, args []string) int {
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	keys, err := external.ResolveGifts(fs.Args())
+	if err != nil {
+		return usageError(fs, "%v", err)
+	}
+	count, err := parser.ParseGifts(ctx, keys)
+	return finishRun("Scrape", count, err)
+}
+
+func runUpdate(ctx context.Context, cfg config.Config, fs *flag.FlagSet, args []string) int {
+	commit := fs.Bool("commit", false, "commit and push the databases when new rows were stored")
+	if code, ok := parseArgs(fs, args, 0); !ok {
+		return code
+	}
+
+	count, err := external.RunUpdater(ctx)
+	code := finishRun("Update", count, err)
+	// Rows stored by the collections that succeeded are pushed even when
+	// another one failed.
+	if *commit && count > 0 && code != exitInterrupted {
+		if err := external.CommitDatabase(count); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailed
+		}
+	}
+	return code
+}
+
+func runDaemon(ctx context.Context, cfg config.Config, fs *flag.FlagSet, args []string) int {
+	if code, ok := parseArgs(fs, args, 0); !ok {
+		return code
+	}
+	// Like serve, the daemon is meant to be stopped by a signal, so that is
+	// not an error.
+	if err := external.ScheduleUpdater(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintln(os.Stderr, "Updater failed:", err)
+		return exitFailed
+	}
+	return exitOK
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ", ") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
+
+func runQuery(ctx context.Context, cfg config.Config, fs *flag.FlagSet, args []string) int {
+	var gifts stringList
+	var q storage.Query
+	fs.Var(&gifts, "gift", "collection name or slug; repeat for several (default all)")
+	fs.StringVar(&q.Model, "model", "", "model name; a rarity suffix like \"(1.5%)\" is ignored")
+	fs.StringVar(&q.Backdrop, "backdrop", "", "backdrop name")
+	fs.StringVar(&q.Symbol, "symbol", "", "symbol name")
+	fs.StringVar(&q.Owner, "owner", "", "owner display name or username")
+	number := fs.Int("number", 0, "gift number, e.g. 1 for every #1")
+	format := fs.String("format", "table", "output format: "+strings.Join(external.QueryFormats, ", "))
+	group := fs.Bool("group", false, "group results by collection (table and json only)")
+	limit := fs.Int("limit", 0, "stop after this many rows (0 for all)")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if !slices.Contains(external.QueryFormats, *format) {
+		return usageError(fs, "unknown format %q", *format)
+	}
+	if *group && !slices.Contains(external.GroupedQueryFormats, *format) {
+		return usageError(fs, "-group needs -format %s", strings.Join(external.GroupedQueryFormats, " or "))
+	}
+	if *number < 0 || *number > math.MaxInt32 {
+		return usageError(fs, "invalid -number %d", *number)
+	}
+	q.Number = int32(*number)
+	q = external.NormalizeQuery(q)
+	if q == (storage.Query{}) {
+		return usageError(fs, "query needs at least one of -model, -backdrop, -symbol, -owner or -number")
+	}
+	keys, err := external.ResolveGifts(append(gifts, fs.Args()...))
+	if err != nil {
+		return usageError(fs, "%v", err)
+	}
+
+	results, err := external.QueryGifts(ctx, keys, q, cfg.Scraper.BaseURL, *limit)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintln(os.Stderr, "Query failed:", err)
+		return exitFailed
+	}
+	if *group {
+		err = external.WriteQueryGroups(os.Stdout, *format, external.GroupQueryResults(results))
+	} else {
+		err = external.WriteQueryResults(os.Stdout, *format, results)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to write results:", err)
+		return exitFailed
+	}
+
+	switch {
+	case ctx.Err() != nil:
+		return exitInterrupted
+	case len(results) == 0:
+		return exitProblems
+	}
+	return exitOK
+}
+
+func runStats(ctx context.Context, cfg config.Config, fs *flag.FlagSet, args []string) int {
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	keys, err := external.ResolveGifts(fs.Args())
+	if err != nil {
+		return usageError(fs, "%v", err)
+	}
+	all, err := external.CollectStats(keys)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to collect stats:", err)
+		return exitFailed
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "GIFT\tROWS\tOK\tFAILED\tMISSING\tDUPES\tISSUED\tTOTAL\tCOVERAGE")
+	for _, s := range all {
+		coverage := "-"
+		if s.Issued > 0 {
+			coverage = fmt.Sprintf("%.1f%%", s.Coverage()*100)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%s\n",
+			s.Name, s.Rows, s.OK, s.Failed, s.Missing, s.Duplicates, s.Issued, s.Total, coverage)
+	}
+	w.Flush()
+	return exitOK
+}
+
+func runExport(ctx context.Context, cfg config.Config, fs *flag.FlagSet, args []string) int {
+	out := fs.String("o", "-", "output file, - for stdout")
+	format := fs.String("format", "csv", "output format: "+strings.Join(external.ExportFormats, ", "))
+	columns := fs.String("columns", "", "comma-separated columns to write, all when empty: "+strings.Join(external.ExportColumnNames(), ","))
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if !slices.Contains(external.ExportFormats, *format) {
+		return usageError(fs, "unknown format %q", *format)
+	}
+	if *format == "sqlite" && *out == "-" {
+		return usageError(fs, "sqlite export needs -o file")
+	}
+	var selected []string
+	if *columns != "" {
+		selected = strings.Split(*columns, ",")
+		for i, name := range selected {
+			selected[i] = strings.TrimSpace(name)
+			if !slices.Contains(external.ExportColumnNames(), selected[i]) {
+				return usageError(fs, "unknown column %q", selected[i])
+			}
+			if slices.Contains(selected[:i], selected[i]) {
+				return usageError(fs, "column %q given twice", selected[i])
+			}
+		}
+	}
+
+	// With no gifts named every database on disk is exported, including
+	// collections that have since left the catalog.
+	var keys []string
+	if fs.NArg() > 0 {
+		var err error
+		if keys, err = external.ResolveGifts(fs.Args()); err != nil {
+			return usageError(fs, "%v", err)
+		}
+	}
+
+	count, err := external.Export(ctx, *format, *out, keys, selected)
+	if *out != "-" && err == nil {
+		fmt.Fprintf(os.Stderr, "Exported %d rows to %s\n", count, *out)
+	}
+	return finishRun("Export", count, err)
+}
+
+func runVerify(ctx context.Context, cfg config.Config, fs *flag.FlagSet, args []string) int {
+	if code, ok := parseArgs(fs, args, 0); !ok {
+		return code
+	}
+
+	problems, err := external.VerifyDatabases()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Database check failed:", err)
+		return exitFailed
+	}
+
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		return exitProblems
+	}
+	fmt.Println("No problems found")
+	return exitOK
+}
+
+func runServe(ctx context.Context, cfg config.Config, fs *flag.FlagSet, args []string) int {
+	addr := fs.String("addr", external.DefaultServeAddr, "address to listen on")
+	if code, ok := parseArgs(fs, args, 0); !ok {
+		return code
+	}
+	fmt.Printf("Serving %s on http://%s\n", storage.Dir, *addr)
+	// A signal is how a server is meant to stop, so it is not an error.
+	if err := external.Serve(ctx, *addr); err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintln(os.Stderr, "Server failed:", err)
+		return exitFailed
+	}
+	return exitOK
+}
+
+func runRepair(ctx context.Context, cfg config.Config, fs *flag.FlagSet, args []string) int {
+	if code, ok := parseArgs(fs, args, 0); !ok {
+		return code
+	}
+	count, err := external.RunRepair(ctx)
+	return finishRun("Repair", count, err)
+}
+
+func runRefresh(ctx context.Context, cfg config.Config, fs *flag.FlagSet, args []string) int {
+	opts := external.RefreshOptions{}
+	fs.StringVar(&opts.Strategy, "strategy", external.RefreshOldest, "oldest, random or full")
+	fs.IntVar(&opts.Sample, "sample", 200, "rows re-fetched per collection")
+	if code, ok := parseArgs(fs, args, 0); !ok {
+		return code
+	}
+	if !slices.Contains(external.RefreshStrategies, opts.Strategy) {
+		return usageError(fs, "unknown strategy %q", opts.Strategy)
+	}
+	if opts.Sample < 0 {
+		return usageError(fs, "invalid -sample %d", opts.Sample)
+	}
+	count, err := external.RunRefresh(ctx, opts)
+	return finishRun("Refresh", count, err)
+}
+
+func runReparse(ctx context.Context, cfg config.Config, fs *flag.FlagSet, args []string) int {
+	if code, ok := parseArgs(fs, args, 1); !ok {
+		return code
+	}
+	dir := filepath.Join(cfg.DataDir, "archive")
+	if fs.NArg() > 0 {
+		dir = fs.Arg(0)
+	} else if cfg.Scraper.Archive != "" {
+		dir = cfg.Scraper.Archive
+	}
+	count, err := external.RunReparse(ctx, dir)
+	return finishRun("Reparse", count, err)
+}
+
+func runCoordinator(ctx context.Context, cfg config.Config, fs *flag.FlagSet, args []string) int {
+	if code, ok := parseArgs(fs, args, 1); !ok {
+		return code
+	}
+	addr := cfg.Cluster.Addr
+	if fs.NArg() > 0 {
+		addr = fs.Arg(0)
+	}
+	count, err := external.RunCoordinator(ctx, addr, cfg.Cluster.Token)
+	return finishRun("Coordinator", count, err)
+}
+
+func runWorker(ctx context.Context, cfg config.Config, fs *flag.FlagSet, args []string) int {
+	if code, ok := parseArgs(fs, args, 2); !ok {
+		return code
+	}
+	if fs.NArg() < 1 {
+		return usageError(fs, "missing coordinator URL")
+	}
+	slots := 1
+	if fs.NArg() > 1 {
+		n, err := strconv.Atoi(fs.Arg(1))
+		if err != nil || n < 1 {
+			return usageError(fs, "invalid slot count %q", fs.Arg(1))
+		}
+		slots = n
+	}
+	count, err := external.RunWorker(ctx, fs.Arg(0), cfg.Cluster.Token, slots)
+	return finishRun("Worker", count, err)
+}
+
+func runMigrate(ctx context.Context, cfg config.Config, fs *flag.FlagSet, args []string) int {
+	if code, ok := parseArgs(fs, args, 0); !ok {
+		return code
+	}
+	count, err := storage.MigrateDir(storage.Dir, func(path string) {
+		progress.Emit(progress.Event{Kind: progress.Info, Op: "migrate", Message: fmt.Sprintf("Migrated %s to schema v%d", path, storage.SchemaVersion)})
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Migration failed:", err)
+		return exitFailed
+	}
+	progress.Emit(progress.Event{Kind: progress.Info, Op: "migrate", Count: count, Message: fmt.Sprintf("Migrated %d parquet files", count)})
+	return exitOK
+}
+
+func runConvert(ctx context.Context, cfg config.Config, fs *flag.FlagSet, args []string) int {
+	to := fs.String("to", storage.BackendSQLite, "backend to convert to: "+strings.Join(storage.Backends, ", "))
+	if code, ok := parseArgs(fs, args, 0); !ok {
+		return code
+	}
+	if !slices.Contains(storage.Backends, *to) {
+		return usageError(fs, "unknown backend %q", *to)
+	}
+
+	count, err := storage.ConvertDir(storage.Dir, *to, func(c storage.Conversion) {
+		message := fmt.Sprintf("Converted %s to %s (%d rows)", c.Src, c.Dst, c.Rows)
+		if c.Skipped {
+			message = fmt.Sprintf("Skipping %s, %s already exists", c.Src, c.Dst)
+		}
+		progress.Emit(progress.Event{Kind: progress.Info, Op: "convert", Count: c.Rows, Message: message})
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Conversion failed:", err)
+		return exitFailed
+	}
+	progress.Emit(progress.Event{Kind: progress.Info, Op: "convert", Count: count, Message: fmt.Sprintf("Converted %d collections to %s", count, *to)})
+	if *to != cfg.Storage.Backend {
+		fmt.Fprintf(os.Stderr, "Set storage.backend = %q (or -storage %s) to use them\n", *to, *to)
+	}
+	return exitOK
+}
+
+func runDiscover(ctx context.Context, cfg config.Config, fs *flag.FlagSet, args []string) int {
+	apply := fs.Bool("apply", false, "add the collections found to the catalog")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	// Telegram has no public list of collections, so discover only checks
+	// names it is given.
+	candidates := fs.Args()
+	if len(candidates) == 0 {
+		var err error
+		candidates, err = external.LoadCandidates(external.CandidatesPath)
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Fprintln(os.Stderr, "Failed to load candidate list:", err)
+			return exitFailed
+		}
+	}
+	if len(candidates) == 0 {
+		return usageError(fs, "no candidates to probe: give names or slugs as arguments or list them, one per line, in %s", external.CandidatesPath)
+	}
+	found, err := external.Discover(ctx, candidates, *apply)
+	return finishRun("Discovery", len(found), err)
+}
+
+func runCatalog(ctx context.Context, cfg config.Config, fs *flag.FlagSet, args []string) int {
+	dryRun := fs.Bool("dry-run", false, "only report the differences")
+	switch {
+	case len(args) > 0 && args[0] == "rebuild":
+		args = args[1:]
+	case len(args) > 0 && slices.Contains([]string{"-h", "-help", "--help"}, args[0]):
+		// Left for parseFlags, which prints the usage.
+	case len(args) == 0 || strings.HasPrefix(args[0], "-"):
+		return usageError(fs, "missing catalog action")
+	default:
+		return usageError(fs, "unknown catalog action %q", args[0])
+	}
+	if code, ok := parseArgs(fs, args, 0); !ok {
+		return code
+	}
+
+	diff, err := external.RebuildCatalog(*dryRun)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Catalog rebuild failed:", err)
+		return exitFailed
+	}
+	diff.Print()
+	return exitOK
+}
@@ -0,0 +1,238 @@
+package external
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"tg-gifts-parser/internal/parser"
+	"tg-gifts-parser/internal/storage"
+)
+
+type baseCatalog struct {
+	Backdrops []string `json:"backdrops"`
+	Symbols   []string `json:"symbols"`
+}
+
+// CatalogDiff lists catalog entries that appeared in or vanished from the
+// observed data, keyed by gift name for models.
+type CatalogDiff struct {
+	NewModels         map[string][]string
+	VanishedModels    map[string][]string
+	NewBackdrops      []string
+	VanishedBackdrops []string
+	NewSymbols        []string
+	VanishedSymbols   []string
+}
+
+func (d CatalogDiff) Empty() bool {
+	return len(d.NewModels) == 0 && len(d.VanishedModels) == 0 &&
+		len(d.NewBackdrops) == 0 && len(d.VanishedBackdrops) == 0 &&
+		len(d.NewSymbols) == 0 && len(d.VanishedSymbols) == 0
+}
+
+func (d CatalogDiff) Print() {
+	if d.Empty() {
+		fmt.Println("Catalog is up to date")
+		return
+	}
+
+	names := make([]string, 0, len(d.NewModels)+len(d.VanishedModels))
+	seen := make(map[string]bool)
+	for _, m := range []map[string][]string{d.NewModels, d.VanishedModels} {
+		for name := range m {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Printf("%s:\n", name)
+		printEntries("+", d.NewModels[name])
+		printEntries("-", d.VanishedModels[name])
+	}
+	if len(d.NewBackdrops)+len(d.VanishedBackdrops) > 0 {
+		fmt.Println("Backdrops:")
+		printEntries("+", d.NewBackdrops)
+		printEntries("-", d.VanishedBackdrops)
+	}
+	if len(d.NewSymbols)+len(d.VanishedSymbols) > 0 {
+		fmt.Println("Symbols:")
+		printEntries("+", d.NewSymbols)
+		printEntries("-", d.VanishedSymbols)
+	}
+}
+
+func printEntries(sign string, entries []string) {
+	for _, e := range entries {
+		fmt.Printf("  %s %s\n", sign, e)
+	}
+}
+
+// diffNames returns the entries only in fresh and the entries only in old,
+// comparing names without their rarity.
+func diffNames(old, fresh []string) (added, vanished []string) {
+	oldNames := make(map[string]bool, len(old))
+	for _, s := range old {
+		name, _ := storage.SplitAttribute(s)
+		oldNames[name] = true
+	}
+	freshNames := make(map[string]bool, len(fresh))
+	for _, s := range fresh {
+		name, _ := storage.SplitAttribute(s)
+		freshNames[name] = true
+		if !oldNames[name] {
+			added = append(added, s)
+		}
+	}
+	for _, s := range old {
+		if name, _ := storage.SplitAttribute(s); !freshNames[name] {
+			vanished = append(vanished, s)
+		}
+	}
+	return added, vanished
+}
+
+// observedModels returns the models seen in gifts, rarest first, with the
+// rarity most rows agree on.
+func observedModels(gifts []storage.Gift) []string {
+	counts := make(map[string]map[int32]int)
+	for _, g := range gifts {
+		if g.Status != storage.StatusOK || g.Model == "" || g.Model == "Unknown" {
+			continue
+		}
+		if counts[g.Model] == nil {
+			counts[g.Model] = make(map[int32]int)
+		}
+		counts[g.Model][g.ModelRarity]++
+	}
+
+	type model struct {
+		name   string
+		rarity int32
+	}
+	models := make([]model, 0, len(counts))
+	for name, rarities := range counts {
+		best, bestCount := int32(0), -1
+		for rarity, n := range rarities {
+			if n > bestCount || (n == bestCount && rarity < best) {
+				best, bestCount = rarity, n
+			}
+		}
+		models = append(models, model{name, best})
+	}
+	sort.Slice(models, func(i, j int) bool {
+		if models[i].rarity != models[j].rarity {
+			return models[i].rarity < models[j].rarity
+		}
+		return models[i].name < models[j].name
+	})
+
+	list := make([]string, len(models))
+	for i, m := range models {
+		list[i] = storage.JoinAttribute(m.name, m.rarity)
+	}
+	return list
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// RebuildCatalog rewrites the model lists in gifts.json and the backdrop and
+// symbol lists in base.json from what the databases contain. Collections
+// without stored rows keep their current models.
+func RebuildCatalog(dryRun bool) (CatalogDiff, error) {
+	diff := CatalogDiff{
+		NewModels:      make(map[string][]string),
+		VanishedModels: make(map[string][]string),
+	}
+
+	catalog, err := readGiftsCatalog(parser.CatalogPath)
+	if err != nil {
+		return diff, fmt.Errorf("failed to load gifts JSON: %w", err)
+	}
+
+	raw, err := os.ReadFile(parser.BasePath)
+	if err != nil {
+		return diff, fmt.Errorf("failed to load base JSON: %w", err)
+	}
+	var base baseCatalog
+	if err := json.Unmarshal(raw, &base); err != nil {
+		return diff, fmt.Errorf("failed to parse base JSON: %w", err)
+	}
+
+	backdrops := make(map[string]bool)
+	symbols := make(map[string]bool)
+	for _, key := range catalog.Keys() {
+		store, err := storage.Open(storage.Dir, parser.SanitizeKey(key))
+		if err != nil {
+			return diff, fmt.Errorf("open store for %q: %w", key, err)
+		}
+		gifts, err := storage.ReadAll(store)
+		if err != nil {
+			return diff, fmt.Errorf("read %q: %w", key, err)
+		}
+		if len(gifts) == 0 {
+			continue
+		}
+
+		for _, g := range gifts {
+			if g.Status != storage.StatusOK {
+				continue
+			}
+			if g.Backdrop != "" && g.Backdrop != "Unknown" {
+				backdrops[g.Backdrop] = true
+			}
+			if g.Symbol != "" && g.Symbol != "Unknown" {
+				symbols[g.Symbol] = true
+			}
+		}
+
+		var current []string
+		if v, ok := catalog.Get(key); ok {
+			b, _ := json.Marshal(v)
+			_ = json.Unmarshal(b, &current)
+		}
+		models := observedModels(gifts)
+		added, vanished := diffNames(current, models)
+		if len(added) > 0 {
+			diff.NewModels[key] = added
+		}
+		if len(vanished) > 0 {
+			diff.VanishedModels[key] = vanished
+		}
+		catalog.Set(key, models)
+	}
+
+	if len(backdrops) > 0 {
+		fresh := sortedKeys(backdrops)
+		diff.NewBackdrops, diff.VanishedBackdrops = diffNames(base.Backdrops, fresh)
+		base.Backdrops = fresh
+	}
+	if len(symbols) > 0 {
+		fresh := sortedKeys(symbols)
+		diff.NewSymbols, diff.VanishedSymbols = diffNames(base.Symbols, fresh)
+		base.Symbols = fresh
+	}
+
+	if dryRun {
+		return diff, nil
+	}
+	if err := writeJSONFile(parser.CatalogPath, catalog); err != nil {
+		return diff, fmt.Errorf("write gifts JSON: %w", err)
+	}
+	if err := writeJSONFile(parser.BasePath, base); err != nil {
+		return diff, fmt.Errorf("write base JSON: %w", err)
+	}
+	return diff, nil
+}
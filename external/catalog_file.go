@@ -0,0 +1,43 @@
+package external
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+
+	"tg-gifts-parser/internal/storage"
+
+	"github.com/iancoleman/orderedmap"
+)
+
+func readGiftsCatalog(path string) (*orderedmap.OrderedMap, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	catalog := orderedmap.New()
+	catalog.SetEscapeHTML(false)
+	if err := json.Unmarshal(raw, catalog); err != nil {
+		return nil, err
+	}
+	return catalog, nil
+}
+
+// writeJSONFile keeps the 4-space indentation and unescaped text of the
+// hand-edited files under data/.
+func writeJSONFile(path string, v interface{}) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "    ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+
+	return storage.WriteFileAtomic(path, func(w io.Writer) error {
+		_, err := w.Write(buf.Bytes())
+		return err
+	})
+}
@@ -0,0 +1,39 @@
+package external
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"tg-gifts-parser/internal/cluster"
+	"tg-gifts-parser/internal/parser"
+	"tg-gifts-parser/internal/storage"
+)
+
+// RunCoordinator plans ranges for every collection in gifts.json and serves
+// them to workers on addr. A non-empty token must match on both sides.
+func RunCoordinator(ctx context.Context, addr, token string) (int, error) {
+	// Checked before planning, which fetches every collection's supply.
+	if err := cluster.CheckListenToken(addr, token); err != nil {
+		return 0, err
+	}
+	keys, err := parser.LoadGiftsJSON(parser.CatalogPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load gifts JSON: %w", err)
+	}
+	if err := os.MkdirAll(storage.Dir, 0755); err != nil {
+		return 0, fmt.Errorf("failed to create database folder: %w", err)
+	}
+
+	ranges, err := cluster.PlanRanges(ctx, storage.Dir, keys, cluster.RangeSize)
+	if err != nil {
+		return 0, err
+	}
+	return cluster.NewCoordinator(storage.Dir, token, ranges).Run(ctx, addr)
+}
+
+func RunWorker(ctx context.Context, coordinator, token string, slots int) (int, error) {
+	w := cluster.NewWorker(coordinator, token)
+	w.Slots = slots
+	return w.Run(ctx)
+}
@@ -0,0 +1,138 @@
+package external
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"tg-gifts-parser/internal/parser"
+	"tg-gifts-parser/internal/progress"
+	"tg-gifts-parser/internal/storage"
+)
+
+var CandidatesPath = "data/candidates.txt"
+
+type Discovery struct {
+	Name  string
+	Slug  string
+	Model string
+}
+
+func LoadCandidates(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var candidates []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			candidates = append(candidates, line)
+		}
+	}
+	return candidates, scanner.Err()
+}
+
+// displayNameFor falls back to the candidate itself, or splits a CamelCase
+// slug into words, when the page has no usable title.
+func displayNameFor(candidate, slug string) string {
+	if strings.ContainsRune(candidate, ' ') {
+		return strings.TrimSpace(candidate)
+	}
+
+	var b strings.Builder
+	for i, r := range slug {
+		if i > 0 && unicode.IsUpper(r) {
+			b.WriteRune(' ')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func probeCandidate(ctx context.Context, candidate string) (*Discovery, error) {
+	slug := parser.SanitizeKey(candidate)
+	doc, err := parser.FetchPage(ctx, slug, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	name := parser.ExtractGiftTitle(doc)
+	if name == "" {
+		name = displayNameFor(candidate, slug)
+	}
+	if parser.SanitizeKey(name) != slug {
+		return nil, fmt.Errorf("title %q does not map back to slug %s", name, slug)
+	}
+
+	model, rarity := storage.SplitAttribute(parser.ExtractGiftField(doc, "Model"))
+	return &Discovery{Name: name, Slug: slug, Model: storage.JoinAttribute(model, rarity)}, nil
+}
+
+// Discover probes candidate names or slugs that gifts.json does not know yet
+// and, when apply is set, adds the ones Telegram serves a page for. It cannot
+// find collections on its own; the candidates have to come from the caller.
+func Discover(ctx context.Context, candidates []string, apply bool) ([]Discovery, error) {
+	if len(candidates) == 0 {
+		return nil, errors.New("no candidates to probe")
+	}
+	catalog, err := readGiftsCatalog(parser.CatalogPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load gifts JSON: %w", err)
+	}
+
+	known := make(map[string]bool)
+	for _, key := range catalog.Keys() {
+		known[parser.SanitizeKey(key)] = true
+	}
+
+	var found []Discovery
+	for _, candidate := range candidates {
+		slug := parser.SanitizeKey(candidate)
+		if slug == "" || known[slug] {
+			continue
+		}
+		known[slug] = true
+
+		d, err := probeCandidate(ctx, candidate)
+		if ctx.Err() != nil {
+			return found, ctx.Err()
+		}
+		if errors.Is(err, parser.ErrNotFound) {
+			progress.Emit(progress.Event{Kind: progress.Info, Op: "discover", Slug: slug, Message: slug + ": no such collection"})
+			continue
+		}
+		if err != nil {
+			progress.Emit(progress.Event{Kind: progress.Warning, Op: "discover", Gift: candidate, Slug: slug, Message: "could not probe", Error: err.Error()})
+			continue
+		}
+
+		progress.Emit(progress.Event{Kind: progress.Info, Op: "discover", Gift: d.Name, Slug: d.Slug, Message: fmt.Sprintf("Found new collection %q (%s)", d.Name, d.Slug)})
+		found = append(found, *d)
+	}
+
+	if !apply || len(found) == 0 {
+		return found, nil
+	}
+
+	for _, d := range found {
+		models := []string{}
+		if d.Model != "" && d.Model != "Unknown" {
+			models = append(models, d.Model)
+		}
+		catalog.Set(d.Name, models)
+	}
+	if err := writeJSONFile(parser.CatalogPath, catalog); err != nil {
+		return found, fmt.Errorf("write gifts JSON: %w", err)
+	}
+
+	progress.Emit(progress.Event{Kind: progress.Info, Op: "discover", Count: len(found), Message: fmt.Sprintf("Added %d collections to %s", len(found), parser.CatalogPath)})
+	return found, nil
+}
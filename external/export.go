@@ -0,0 +1,378 @@
+package external
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"tg-gifts-parser/internal/parser"
+	"tg-gifts-parser/internal/storage"
+
+	_ "modernc.org/sqlite"
+)
+
+// ExportFormats are the formats Export writes.
+var ExportFormats = []string{"csv", "ndjson", "sqlite"}
+
+type exportColumn struct {
+	name    string
+	sqlType string
+	// indexed columns get a SQLite index together with the gift name.
+	indexed bool
+	value   func(g storage.Gift) any
+}
+
+// exportColumns are every exportable column in their default order.
+// Rarities are in permille, as stored.
+var exportColumns = []exportColumn{
+	{"name", "TEXT", false, func(g storage.Gift) any { return g.Name }},
+	{"number", "INTEGER", false, func(g storage.Gift) any { return g.Number }},
+	{"status", "TEXT", true, func(g storage.Gift) any { return g.Status }},
+	{"model", "TEXT", true, func(g storage.Gift) any { return g.Model }},
+	{"model_rarity", "INTEGER", false, func(g storage.Gift) any { return g.ModelRarity }},
+	{"backdrop", "TEXT", true, func(g storage.Gift) any { return g.Backdrop }},
+	{"backdrop_rarity", "INTEGER", false, func(g storage.Gift) any { return g.BackdropRarity }},
+	{"symbol", "TEXT", true, func(g storage.Gift) any { return g.Symbol }},
+	{"symbol_rarity", "INTEGER", false, func(g storage.Gift) any { return g.SymbolRarity }},
+	{"owner_name", "TEXT", false, func(g storage.Gift) any { return g.OwnerName }},
+	{"owner_username", "TEXT", true, func(g storage.Gift) any { return g.OwnerUsername }},
+	{"owner_hidden", "INTEGER", false, func(g storage.Gift) any { return g.OwnerHidden }},
+	{"fetched_at", "INTEGER", false, func(g storage.Gift) any { return g.FetchedAt }},
+}
+
+// ExportColumnNames lists every column Export can write.
+func ExportColumnNames() []string {
+	names := make([]string, len(exportColumns))
+	for i, c := range exportColumns {
+		names[i] = c.name
+	}
+	return names
+}
+
+func selectColumns(names []string) ([]exportColumn, error) {
+	if len(names) == 0 {
+		return exportColumns, nil
+	}
+	selected := make([]exportColumn, 0, len(names))
+	for _, name := range names {
+		i := -1
+		for j, c := range exportColumns {
+			if c.name == name {
+				i = j
+			}
+		}
+		if i < 0 {
+			return nil, fmt.Errorf("unknown column %q, want some of %s", name, strings.Join(ExportColumnNames(), ","))
+		}
+		selected = append(selected, exportColumns[i])
+	}
+	return selected, nil
+}
+
+// exportSink receives the rows of one collection at a time, in batches.
+type exportSink interface {
+	write(gifts []storage.Gift) error
+	close() error
+}
+
+type csvSink struct {
+	w       *csv.Writer
+	columns []exportColumn
+}
+
+func newCSVSink(w io.Writer, columns []exportColumn) (*csvSink, error) {
+	s := &csvSink{w: csv.NewWriter(w), columns: columns}
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = c.name
+	}
+	return s, s.w.Write(header)
+}
+
+func (s *csvSink) write(gifts []storage.Gift) error {
+	record := make([]string, len(s.columns))
+	for _, g := range gifts {
+		for i, c := range s.columns {
+			record[i] = fmt.Sprint(c.value(g))
+		}
+		if err := s.w.Write(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *csvSink) close() error {
+	s.w.Flush()
+	return s.w.Error()
+}
+
+// ndjsonSink writes one object per row with the keys in column order.
+type ndjsonSink struct {
+	w       *bufio.Writer
+	columns []exportColumn
+	keys    [][]byte
+}
+
+func newNDJSONSink(w io.Writer, columns []exportColumn) *ndjsonSink {
+	s := &ndjsonSink{w: bufio.NewWriter(w), columns: columns}
+	for _, c := range columns {
+		key, _ := json.Marshal(c.name)
+		s.keys = append(s.keys, key)
+	}
+	return s
+}
+
+func (s *ndjsonSink) write(gifts []storage.Gift) error {
+	for _, g := range gifts {
+		s.w.WriteByte('{')
+		for i, c := range s.columns {
+			if i > 0 {
+				s.w.WriteByte(',')
+			}
+			value, err := json.Marshal(c.value(g))
+			if err != nil {
+				return err
+			}
+			s.w.Write(s.keys[i])
+			s.w.WriteByte(':')
+			s.w.Write(value)
+		}
+		if _, err := s.w.WriteString("}\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ndjsonSink) close() error {
+	return s.w.Flush()
+}
+
+// sqliteSink loads rows into a gifts table, one transaction per batch, and
+// builds the indexes once everything is in.
+type sqliteSink struct {
+	db      *sql.DB
+	insert  string
+	columns []exportColumn
+}
+
+func newSQLiteSink(path string, columns []exportColumn) (*sqliteSink, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// Pragmas are per connection; keep to one so they stick.
+	db.SetMaxOpenConns(1)
+
+	defs := make([]string, len(columns))
+	marks := make([]string, len(columns))
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		defs[i] = c.name + " " + c.sqlType
+		marks[i] = "?"
+		names[i] = c.name
+	}
+	// The file is rebuilt from scratch on every export, so durability while
+	// loading buys nothing.
+	stmts := []string{
+		"PRAGMA journal_mode = OFF",
+		"PRAGMA synchronous = OFF",
+		"CREATE TABLE gifts (" + strings.Join(defs, ", ") + ")",
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return &sqliteSink{
+		db:      db,
+		insert:  "INSERT INTO gifts (" + strings.Join(names, ", ") + ") VALUES (" + strings.Join(marks, ", ") + ")",
+		columns: columns,
+	}, nil
+}
+
+func (s *sqliteSink) write(gifts []storage.Gift) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(s.insert)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	args := make([]any, len(s.columns))
+	for _, g := range gifts {
+		for i, c := range s.columns {
+			args[i] = c.value(g)
+		}
+		if _, err := stmt.Exec(args...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteSink) close() error {
+	hasName, hasNumber := false, false
+	for _, c := range s.columns {
+		hasName = hasName || c.name == "name"
+		hasNumber = hasNumber || c.name == "number"
+	}
+
+	var stmts []string
+	switch {
+	case hasName && hasNumber:
+		stmts = append(stmts, "CREATE INDEX gifts_name_number ON gifts (name, number)")
+	case hasName:
+		stmts = append(stmts, "CREATE INDEX gifts_name ON gifts (name)")
+	}
+	for _, c := range s.columns {
+		if !c.indexed {
+			continue
+		}
+		if hasName {
+			stmts = append(stmts, fmt.Sprintf("CREATE INDEX gifts_%s ON gifts (%s, name)", c.name, c.name))
+		} else {
+			stmts = append(stmts, fmt.Sprintf("CREATE INDEX gifts_%s ON gifts (%s)", c.name, c.name))
+		}
+	}
+	stmts = append(stmts, "ANALYZE")
+
+	for _, stmt := range stmts {
+		if _, err := s.db.Exec(stmt); err != nil {
+			s.db.Close()
+			return err
+		}
+	}
+	return s.db.Close()
+}
+
+// exportFiles returns the collection files of keys, or every collection in
+// storage.Dir when keys is empty.
+func exportFiles(keys []string) ([]string, error) {
+	if len(keys) == 0 {
+		slugs, err := storage.Slugs(storage.Dir)
+		if err != nil {
+			return nil, err
+		}
+		files := make([]string, len(slugs))
+		for i, slug := range slugs {
+			files[i] = storage.Path(storage.Dir, slug)
+		}
+		return files, nil
+	}
+	files := make([]string, 0, len(keys))
+	for _, key := range keys {
+		path := storage.Path(storage.Dir, parser.SanitizeKey(key))
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("no database for %q: %w", key, err)
+		}
+		files = append(files, path)
+	}
+	return files, nil
+}
+
+// Export streams the stored rows of keys (all collections when empty) to out
+// in format, keeping only columns (all when empty), and returns the number of
+// rows written. out is "-" for stdout, except for sqlite which needs a file;
+// the SQLite file is built next to out and renamed over it when complete.
+// When ctx is cancelled the rows written so far are kept.
+func Export(ctx context.Context, format, out string, keys, columns []string) (int, error) {
+	selected, err := selectColumns(columns)
+	if err != nil {
+		return 0, err
+	}
+	files, err := exportFiles(keys)
+	if err != nil {
+		return 0, err
+	}
+
+	var sink exportSink
+	var finish func(err error) error
+	switch format {
+	case "csv", "ndjson":
+		w := io.Writer(os.Stdout)
+		finish = func(err error) error { return err }
+		if out != "-" {
+			f, err := os.Create(out)
+			if err != nil {
+				return 0, err
+			}
+			w = f
+			finish = func(err error) error {
+				if closeErr := f.Close(); err == nil {
+					err = closeErr
+				}
+				return err
+			}
+		}
+		if format == "csv" {
+			if sink, err = newCSVSink(w, selected); err != nil {
+				return 0, finish(err)
+			}
+		} else {
+			sink = newNDJSONSink(w, selected)
+		}
+	case "sqlite":
+		if out == "-" {
+			return 0, errors.New("sqlite export needs an output file")
+		}
+		tmp := out + ".tmp"
+		os.Remove(tmp)
+		if sink, err = newSQLiteSink(tmp, selected); err != nil {
+			os.Remove(tmp)
+			return 0, err
+		}
+		finish = func(err error) error {
+			if err != nil && !errors.Is(err, context.Canceled) {
+				os.Remove(tmp)
+				return err
+			}
+			if renameErr := os.Rename(tmp, out); renameErr != nil {
+				return renameErr
+			}
+			return err
+		}
+	default:
+		return 0, fmt.Errorf("unknown format %q, want one of %s", format, strings.Join(ExportFormats, ", "))
+	}
+
+	written := 0
+	for _, path := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		err = storage.Scan(path, func(gifts []storage.Gift) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := sink.write(gifts); err != nil {
+				return err
+			}
+			written += len(gifts)
+			return nil
+		})
+		if err != nil && !errors.Is(err, context.Canceled) {
+			sink.close()
+			return written, finish(fmt.Errorf("export %s: %w", path, err))
+		}
+	}
+
+	if err := sink.close(); err != nil {
+		return written, finish(err)
+	}
+	return written, finish(ctx.Err())
+}
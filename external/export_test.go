@@ -0,0 +1,133 @@
+package external
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tg-gifts-parser/internal/storage"
+)
+
+// useTestDatabase stores two small collections in a scratch storage.Dir for
+// the length of the test.
+func useTestDatabase(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	prevDir, prevBackend := storage.Dir, storage.Backend
+	storage.Dir, storage.Backend = filepath.Join(dir, "database"), storage.BackendParquet
+	t.Cleanup(func() { storage.Dir, storage.Backend = prevDir, prevBackend })
+	if err := os.MkdirAll(storage.Dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	collections := map[string][]storage.Gift{
+		"PlushPepe": {
+			{Name: "Plush Pepe", Number: 1, Status: storage.StatusOK, Model: "Cozy Galaxy", ModelRarity: 15, OwnerUsername: "pepe"},
+			{Name: "Plush Pepe", Number: 2, Status: storage.StatusNotFound},
+		},
+		"SwagBag": {
+			{Name: "Swag Bag", Number: 1, Status: storage.StatusOK, Model: "Gold, \"Shiny\""},
+		},
+	}
+	for slug, gifts := range collections {
+		store, err := storage.Open(storage.Dir, slug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Append(gifts...); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestExportText(t *testing.T) {
+	dir := useTestDatabase(t)
+	cases := []struct {
+		format  string
+		keys    []string
+		columns []string
+		want    string
+	}{
+		{"csv", nil, []string{"number", "name", "model"},
+			"number,name,model\n1,Plush Pepe,Cozy Galaxy\n2,Plush Pepe,\n1,Swag Bag,\"Gold, \"\"Shiny\"\"\"\n"},
+		{"csv", []string{"Swag Bag"}, []string{"model_rarity", "owner_hidden"},
+			"model_rarity,owner_hidden\n0,false\n"},
+		{"ndjson", []string{"Plush Pepe"}, []string{"owner_username", "number", "model_rarity"},
+			`{"owner_username":"pepe","number":1,"model_rarity":15}` + "\n" +
+				`{"owner_username":"","number":2,"model_rarity":0}` + "\n"},
+	}
+	for _, c := range cases {
+		out := filepath.Join(dir, "out."+c.format)
+		n, err := Export(context.Background(), c.format, out, c.keys, c.columns)
+		if err != nil {
+			t.Fatalf("%s %v: %v", c.format, c.columns, err)
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != c.want {
+			t.Errorf("%s %v wrote\n%s\nwant\n%s", c.format, c.columns, data, c.want)
+		}
+		if lines := strings.Count(c.want, "\n"); c.format == "csv" && n != lines-1 || c.format == "ndjson" && n != lines {
+			t.Errorf("%s %v reported %d rows", c.format, c.columns, n)
+		}
+	}
+}
+
+func TestExportSQLite(t *testing.T) {
+	dir := useTestDatabase(t)
+	out := filepath.Join(dir, "gifts.db")
+	n, err := Export(context.Background(), "sqlite", out, nil, []string{"name", "number", "model"})
+	if err != nil || n != 3 {
+		t.Fatalf("Export = %d, %v", n, err)
+	}
+	if _, err := os.Stat(out + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temporary file left behind: %v", err)
+	}
+
+	db, err := sql.Open("sqlite", out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var model string
+	if err := db.QueryRow("SELECT model FROM gifts WHERE name = ? AND number = ?", "Plush Pepe", 1).Scan(&model); err != nil || model != "Cozy Galaxy" {
+		t.Fatalf("model = %q, %v", model, err)
+	}
+	if _, err := db.Exec("SELECT status FROM gifts"); err == nil {
+		t.Fatal("a column that was not selected was exported")
+	}
+	var indexes int
+	if err := db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'index'").Scan(&indexes); err != nil || indexes != 2 {
+		t.Fatalf("%d indexes, %v; want name+number and model", indexes, err)
+	}
+}
+
+func TestExportRejects(t *testing.T) {
+	dir := useTestDatabase(t)
+	out := filepath.Join(dir, "out")
+	cases := []struct {
+		format  string
+		out     string
+		keys    []string
+		columns []string
+	}{
+		{"xml", out, nil, nil},
+		{"csv", out, nil, []string{"price"}},
+		{"csv", out, []string{"Missing Gift"}, nil},
+		{"sqlite", "-", nil, nil},
+	}
+	for _, c := range cases {
+		if _, err := Export(context.Background(), c.format, c.out, c.keys, c.columns); err == nil {
+			t.Errorf("Export(%q, %q, %q, %q) succeeded", c.format, c.out, c.keys, c.columns)
+		}
+	}
+}
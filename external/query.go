@@ -0,0 +1,181 @@
+package external
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"tg-gifts-parser/internal/parser"
+	"tg-gifts-parser/internal/storage"
+)
+
+// QueryFormats are the output formats WriteQueryResults understands.
+var QueryFormats = []string{"table", "json", "ndjson", "csv"}
+
+// QueryResult is one matching gift as scripts see it. Rarities are in
+// permille, as stored.
+type QueryResult struct {
+	Gift           string `json:"gift"`
+	Number         int    `json:"number"`
+	URL            string `json:"url"`
+	Model          string `json:"model"`
+	ModelRarity    int32  `json:"model_rarity"`
+	Backdrop       string `json:"backdrop"`
+	BackdropRarity int32  `json:"backdrop_rarity"`
+	Symbol         string `json:"symbol"`
+	SymbolRarity   int32  `json:"symbol_rarity"`
+	Owner          string `json:"owner,omitempty"`
+}
+
+// NormalizeQuery drops the "(1.5%)" rarity suffix the TUI and gifts.json
+// show, so values can be pasted from either.
+func NormalizeQuery(q storage.Query) storage.Query {
+	q.Model, _ = storage.SplitAttribute(q.Model)
+	q.Backdrop, _ = storage.SplitAttribute(q.Backdrop)
+	q.Symbol, _ = storage.SplitAttribute(q.Symbol)
+	q.Owner = strings.TrimPrefix(strings.TrimSpace(q.Owner), "@")
+	return q
+}
+
+// QueryGifts runs q against the stores of keys in parallel and returns up to
+// limit matches (all when limit is 0), with page URLs under baseURL. Results
+// are grouped by collection, in keys order, and by number within each.
+func QueryGifts(ctx context.Context, keys []string, q storage.Query, baseURL string, limit int) ([]QueryResult, error) {
+	slugs := make([]string, len(keys))
+	names := make(map[string]string, len(keys))
+	for i, key := range keys {
+		slugs[i] = parser.SanitizeKey(key)
+		names[slugs[i]] = key
+	}
+
+	found, err := storage.Search(ctx, storage.Dir, slugs, q)
+	source := parser.NewHTTPSource(nil, baseURL)
+	results := []QueryResult{}
+	for _, m := range found {
+		for _, g := range m.Gifts {
+			if limit > 0 && len(results) >= limit {
+				return results, err
+			}
+			owner := g.OwnerUsername
+			if owner == "" {
+				owner = g.OwnerName
+			}
+			results = append(results, QueryResult{
+				Gift:           names[m.Slug],
+				Number:         int(g.Number),
+				URL:            source.PageURL(m.Slug, int(g.Number)),
+				Model:          g.Model,
+				ModelRarity:    g.ModelRarity,
+				Backdrop:       g.Backdrop,
+				BackdropRarity: g.BackdropRarity,
+				Symbol:         g.Symbol,
+				SymbolRarity:   g.SymbolRarity,
+				Owner:          owner,
+			})
+		}
+	}
+	return results, err
+}
+
+// QueryGroup is the matches of one collection.
+type QueryGroup struct {
+	Gift    string        `json:"gift"`
+	Count   int           `json:"count"`
+	Results []QueryResult `json:"results"`
+}
+
+// GroupQueryResults splits results, as QueryGifts orders them, by collection.
+func GroupQueryResults(results []QueryResult) []QueryGroup {
+	groups := []QueryGroup{}
+	for _, r := range results {
+		if n := len(groups); n == 0 || groups[n-1].Gift != r.Gift {
+			groups = append(groups, QueryGroup{Gift: r.Gift})
+		}
+		g := &groups[len(groups)-1]
+		g.Results = append(g.Results, r)
+		g.Count++
+	}
+	return groups
+}
+
+// GroupedQueryFormats are the formats WriteQueryGroups understands.
+var GroupedQueryFormats = []string{"table", "json"}
+
+// WriteQueryGroups renders groups to w as one table section or one JSON
+// object per collection.
+func WriteQueryGroups(w io.Writer, format string, groups []QueryGroup) error {
+	switch format {
+	case "table":
+		for i, g := range groups {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "%s (%d)\n", g.Gift, g.Count)
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "  NUMBER\tMODEL\tBACKDROP\tSYMBOL\tOWNER\tURL")
+			for _, r := range g.Results {
+				fmt.Fprintf(tw, "  %d\t%s\t%s\t%s\t%s\t%s\n", r.Number,
+					storage.JoinAttribute(r.Model, r.ModelRarity),
+					storage.JoinAttribute(r.Backdrop, r.BackdropRarity),
+					storage.JoinAttribute(r.Symbol, r.SymbolRarity), r.Owner, r.URL)
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(groups)
+	}
+	return fmt.Errorf("unknown grouped format %q, want one of %s", format, strings.Join(GroupedQueryFormats, ", "))
+}
+
+// WriteQueryResults renders results to w in one of QueryFormats.
+func WriteQueryResults(w io.Writer, format string, results []QueryResult) error {
+	switch format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "GIFT\tNUMBER\tMODEL\tBACKDROP\tSYMBOL\tOWNER\tURL")
+		for _, r := range results {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%s\n", r.Gift, r.Number,
+				storage.JoinAttribute(r.Model, r.ModelRarity),
+				storage.JoinAttribute(r.Backdrop, r.BackdropRarity),
+				storage.JoinAttribute(r.Symbol, r.SymbolRarity), r.Owner, r.URL)
+		}
+		return tw.Flush()
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	case "ndjson":
+		enc := json.NewEncoder(w)
+		for _, r := range results {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"gift", "number", "url", "model", "model_rarity", "backdrop", "backdrop_rarity", "symbol", "symbol_rarity", "owner"})
+		for _, r := range results {
+			cw.Write([]string{
+				r.Gift, strconv.Itoa(r.Number), r.URL,
+				r.Model, strconv.Itoa(int(r.ModelRarity)),
+				r.Backdrop, strconv.Itoa(int(r.BackdropRarity)),
+				r.Symbol, strconv.Itoa(int(r.SymbolRarity)),
+				r.Owner,
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("unknown format %q, want one of %s", format, strings.Join(QueryFormats, ", "))
+}
@@ -0,0 +1,222 @@
+package external
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"tg-gifts-parser/internal/parser"
+	"tg-gifts-parser/internal/progress"
+	"tg-gifts-parser/internal/storage"
+)
+
+// ChangesPath is the JSON-lines log of attribute changes found by refresh.
+var ChangesPath = "data/changes.jsonl"
+
+const (
+	RefreshOldest = "oldest"
+	RefreshRandom = "random"
+	RefreshFull   = "full"
+)
+
+// RefreshStrategies are the strategies RunRefresh accepts.
+var RefreshStrategies = []string{RefreshOldest, RefreshRandom, RefreshFull}
+
+type RefreshOptions struct {
+	Strategy string
+	// Sample is the number of rows re-fetched per collection; ignored by
+	// RefreshFull.
+	Sample int
+}
+
+type Change struct {
+	Gift   string    `json:"gift"`
+	Number int32     `json:"number"`
+	Field  string    `json:"field"`
+	Old    string    `json:"old"`
+	New    string    `json:"new"`
+	At     time.Time `json:"at"`
+}
+
+var changesMu sync.Mutex
+
+func appendChanges(path string, changes []Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	changesMu.Lock()
+	defer changesMu.Unlock()
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	for _, c := range changes {
+		if err := enc.Encode(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func diffGift(old, fresh storage.Gift) []Change {
+	fields := []struct {
+		name       string
+		before, to string
+	}{
+		{"model", old.Model, fresh.Model},
+		{"backdrop", old.Backdrop, fresh.Backdrop},
+		{"symbol", old.Symbol, fresh.Symbol},
+		{"owner_name", old.OwnerName, fresh.OwnerName},
+		{"owner_username", old.OwnerUsername, fresh.OwnerUsername},
+		{"owner_hidden", strconv.FormatBool(old.OwnerHidden), strconv.FormatBool(fresh.OwnerHidden)},
+		{"status", old.Status, fresh.Status},
+	}
+
+	now := time.Now()
+	var changes []Change
+	for _, f := range fields {
+		if f.before != f.to {
+			changes = append(changes, Change{Gift: fresh.Name, Number: fresh.Number, Field: f.name, Old: f.before, New: f.to, At: now})
+		}
+	}
+	return changes
+}
+
+func pickRefreshTargets(gifts []storage.Gift, opts RefreshOptions) []int {
+	indices := make([]int, len(gifts))
+	for i := range indices {
+		indices[i] = i
+	}
+
+	switch opts.Strategy {
+	case RefreshFull:
+		return indices
+	case RefreshRandom:
+		rand.Shuffle(len(indices), func(i, j int) { indices[i], indices[j] = indices[j], indices[i] })
+	default:
+		sort.SliceStable(indices, func(i, j int) bool {
+			return gifts[indices[i]].FetchedAt < gifts[indices[j]].FetchedAt
+		})
+	}
+
+	if opts.Sample < len(indices) {
+		indices = indices[:max(opts.Sample, 0)]
+	}
+	return indices
+}
+
+func refreshGift(ctx context.Context, key string, opts RefreshOptions) (changed int, err error) {
+	keySlug := parser.SanitizeKey(key)
+	report := progress.Reporter{Op: "refresh", Gift: key, Slug: keySlug}
+	var targets []int
+	defer func() {
+		if len(targets) > 0 || err != nil {
+			report.Finished(changed, len(targets), err)
+		}
+	}()
+
+	store, err := storage.Open(storage.Dir, keySlug)
+	if err != nil {
+		return 0, fmt.Errorf("open store for %q: %w", key, err)
+	}
+	allGifts, err := storage.ReadAll(store)
+	if err != nil {
+		return 0, fmt.Errorf("read gifts: %w", err)
+	}
+
+	targets = pickRefreshTargets(allGifts, opts)
+	if len(targets) == 0 {
+		return 0, nil
+	}
+	report.Emit(progress.Event{Kind: progress.CollectionStarted, Total: len(targets), Message: opts.Strategy})
+
+	var pending []Change
+	flush := func() error {
+		if err := store.Flush(); err != nil {
+			return err
+		}
+		if err := appendChanges(ChangesPath, pending); err != nil {
+			return fmt.Errorf("record changes: %w", err)
+		}
+		pending = nil
+		return nil
+	}
+
+	var aborted error
+	watch := parser.NewLayoutWatch(parser.LayoutWindow, parser.LayoutMinSamples, parser.LayoutMaxRate)
+	writer := parser.NewCheckpointWriter(flush, report)
+	for _, idx := range targets {
+		old := allGifts[idx]
+		doc, err := parser.FetchPage(ctx, keySlug, int(old.Number))
+		if ctx.Err() != nil {
+			break
+		}
+		report.Item(int(old.Number), err)
+		fresh := parser.BuildGift(key, int(old.Number), doc, err)
+		if aborted = watch.Observe(fresh); aborted != nil {
+			break
+		}
+		switch {
+		case fresh.Status == storage.StatusNotFound:
+			burned := old
+			burned.Status = fresh.Status
+			burned.FetchedAt = fresh.FetchedAt
+			fresh = burned
+		case err != nil:
+			// Keep the stored row but record the attempt, so the oldest
+			// strategy gets to other rows before retrying this one.
+			retried := old
+			retried.FetchedAt = fresh.FetchedAt
+			fresh = retried
+		}
+
+		if changes := diffGift(old, fresh); len(changes) > 0 {
+			pending = append(pending, changes...)
+			changed++
+		}
+		if err := store.Replace(fresh); err != nil {
+			return changed, fmt.Errorf("store %s: %w", parser.PageKey(keySlug, int(old.Number)), err)
+		}
+		writer.Wrote(1)
+	}
+
+	if err := writer.Close(); err != nil {
+		return 0, err
+	}
+	if aborted != nil {
+		return changed, aborted
+	}
+	return changed, ctx.Err()
+}
+
+func RunRefresh(ctx context.Context, opts RefreshOptions) (int, error) {
+	if !slices.Contains(RefreshStrategies, opts.Strategy) {
+		return 0, fmt.Errorf("unknown refresh strategy %q", opts.Strategy)
+	}
+	if opts.Sample < 0 {
+		return 0, fmt.Errorf("invalid refresh sample %d", opts.Sample)
+	}
+
+	keys, err := parser.LoadGiftsJSON(parser.CatalogPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load gifts JSON: %w", err)
+	}
+
+	totalChanged, err := forEachCollection(ctx, keys, func(key string) (int, error) {
+		return refreshGift(ctx, key, opts)
+	})
+	progress.Emit(progress.Event{Kind: progress.Totals, Op: "refresh", Count: totalChanged, Total: len(keys), Error: progress.ErrText(err)})
+	return totalChanged, err
+}
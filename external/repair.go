@@ -0,0 +1,118 @@
+package external
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"tg-gifts-parser/internal/parser"
+	"tg-gifts-parser/internal/progress"
+	"tg-gifts-parser/internal/storage"
+)
+
+func repairGift(ctx context.Context, key string) (repaired int, err error) {
+	keySlug := parser.SanitizeKey(key)
+	report := progress.Reporter{Op: "repair", Gift: key, Slug: keySlug}
+	var targets []int
+	defer func() {
+		if len(targets) > 0 || err != nil {
+			report.Finished(repaired, len(targets), err)
+		}
+	}()
+
+	store, err := storage.Open(storage.Dir, keySlug)
+	if err != nil {
+		return 0, fmt.Errorf("open store for %q: %w", key, err)
+	}
+	allGifts, err := storage.ReadAll(store)
+	if err != nil {
+		return 0, fmt.Errorf("read gifts: %w", err)
+	}
+
+	numbers := storage.Numbers(allGifts)
+	gaps := parser.FindGaps(numbers, parser.MaxNumber(numbers))
+	wanted := make(map[int]bool)
+	for _, n := range gaps.Missing {
+		wanted[n] = true
+	}
+	for _, n := range gaps.Duplicates {
+		wanted[n] = true
+	}
+	failed := 0
+	// stored keeps one good row per number, so a duplicate whose re-fetch
+	// fails is cut down to that row instead of being replaced by the failure.
+	stored := make(map[int32]storage.Gift)
+	for _, g := range allGifts {
+		if g.Status == storage.StatusOK {
+			if _, ok := stored[g.Number]; !ok {
+				stored[g.Number] = g
+			}
+		}
+		if storage.IsRetryableStatus(g.Status) && !wanted[int(g.Number)] {
+			wanted[int(g.Number)] = true
+			failed++
+		}
+	}
+	if len(wanted) == 0 {
+		return 0, nil
+	}
+
+	targets = make([]int, 0, len(wanted))
+	for n := range wanted {
+		targets = append(targets, n)
+	}
+	sort.Ints(targets)
+
+	report.Emit(progress.Event{
+		Kind:    progress.CollectionStarted,
+		Total:   len(targets),
+		Message: fmt.Sprintf("%d missing, %d duplicate, %d failed", len(gaps.Missing), len(gaps.Duplicates), failed),
+	})
+
+	var aborted error
+	watch := parser.NewLayoutWatch(parser.LayoutWindow, parser.LayoutMinSamples, parser.LayoutMaxRate)
+	writer := parser.NewCheckpointWriter(store.Flush, report)
+	for _, n := range targets {
+		doc, err := parser.FetchPage(ctx, keySlug, n)
+		if ctx.Err() != nil {
+			break
+		}
+		report.Item(n, err)
+		gift := parser.BuildGift(key, n, doc, err)
+		row := gift
+		if good, ok := stored[int32(n)]; ok && gift.Status != storage.StatusOK {
+			row = good
+		}
+		if err := store.Replace(row); err != nil {
+			return repaired, fmt.Errorf("store %s: %w", parser.PageKey(keySlug, n), err)
+		}
+		if gift.Status == storage.StatusOK {
+			repaired++
+		}
+		if aborted = watch.Observe(gift); aborted != nil {
+			break
+		}
+		writer.Wrote(1)
+	}
+
+	if err := writer.Close(); err != nil {
+		return 0, err
+	}
+	if aborted != nil {
+		return repaired, aborted
+	}
+	return repaired, ctx.Err()
+}
+
+func RunRepair(ctx context.Context) (int, error) {
+	keys, err := parser.LoadGiftsJSON(parser.CatalogPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load gifts JSON: %w", err)
+	}
+
+	totalRepaired, err := forEachCollection(ctx, keys, func(key string) (int, error) {
+		return repairGift(ctx, key)
+	})
+	progress.Emit(progress.Event{Kind: progress.Totals, Op: "repair", Count: totalRepaired, Total: len(keys), Error: progress.ErrText(err)})
+	return totalRepaired, err
+}
@@ -0,0 +1,102 @@
+package external
+
+import (
+	"context"
+	"fmt"
+
+	"tg-gifts-parser/internal/parser"
+	"tg-gifts-parser/internal/progress"
+	"tg-gifts-parser/internal/storage"
+)
+
+// reparseGift rebuilds the rows of one collection that have an archived page.
+// Rows without one are left as they are, and so is a good row whose archived
+// page no longer parses.
+func reparseGift(ctx context.Context, archive *parser.Archive, key string) (reparsed int, err error) {
+	keySlug := parser.SanitizeKey(key)
+	report := progress.Reporter{Op: "reparse", Gift: key, Slug: keySlug}
+	var numbers []int
+	defer func() {
+		if len(numbers) > 0 || err != nil {
+			report.Finished(reparsed, len(numbers), err)
+		}
+	}()
+
+	numbers, err = archive.Numbers(keySlug)
+	if err != nil {
+		return 0, fmt.Errorf("list archive for %q: %w", key, err)
+	}
+	if len(numbers) == 0 {
+		return 0, nil
+	}
+
+	store, err := storage.Open(storage.Dir, keySlug)
+	if err != nil {
+		return 0, fmt.Errorf("open store for %q: %w", key, err)
+	}
+	allGifts, err := storage.ReadAll(store)
+	if err != nil {
+		return 0, fmt.Errorf("read gifts: %w", err)
+	}
+	stored := make(map[int32]storage.Gift)
+	for _, g := range allGifts {
+		if _, ok := stored[g.Number]; !ok && g.Status == storage.StatusOK {
+			stored[g.Number] = g
+		}
+	}
+
+	report.Emit(progress.Event{Kind: progress.CollectionStarted, Total: len(numbers)})
+
+	var aborted error
+	watch := parser.NewLayoutWatch(parser.LayoutWindow, parser.LayoutMinSamples, parser.LayoutMaxRate)
+	writer := parser.NewCheckpointWriter(store.Flush, report)
+	for _, n := range numbers {
+		if ctx.Err() != nil {
+			break
+		}
+
+		doc, fetchedAt, err := archive.Parse(keySlug, n)
+		report.Item(n, err)
+		gift := parser.BuildGift(key, n, doc, err)
+		if !fetchedAt.IsZero() {
+			gift.FetchedAt = fetchedAt.Unix()
+		}
+		row := gift
+		if good, ok := stored[int32(n)]; ok && gift.Status != storage.StatusOK {
+			row = good
+		} else {
+			reparsed++
+		}
+		if err := store.Replace(row); err != nil {
+			return reparsed, fmt.Errorf("store %s: %w", parser.PageKey(keySlug, n), err)
+		}
+		if aborted = watch.Observe(gift); aborted != nil {
+			break
+		}
+		writer.Wrote(1)
+	}
+
+	if err := writer.Close(); err != nil {
+		return 0, err
+	}
+	if aborted != nil {
+		return reparsed, aborted
+	}
+	return reparsed, ctx.Err()
+}
+
+// RunReparse rebuilds the stored rows of every collection from the page
+// archive in dir, using the current parser and no network access.
+func RunReparse(ctx context.Context, dir string) (int, error) {
+	keys, err := parser.LoadGiftsJSON(parser.CatalogPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load gifts JSON: %w", err)
+	}
+
+	archive := &parser.Archive{Dir: dir}
+	totalReparsed, err := forEachCollection(ctx, keys, func(key string) (int, error) {
+		return reparseGift(ctx, archive, key)
+	})
+	progress.Emit(progress.Event{Kind: progress.Totals, Op: "reparse", Count: totalReparsed, Total: len(keys), Error: progress.ErrText(err)})
+	return totalReparsed, err
+}
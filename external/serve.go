@@ -0,0 +1,143 @@
+package external
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"tg-gifts-parser/internal/parser"
+	"tg-gifts-parser/internal/storage"
+)
+
+// DefaultServeAddr is where Serve listens when no address is given.
+const DefaultServeAddr = "127.0.0.1:8080"
+
+const (
+	// ServeDefaultLimit and ServeMaxLimit bound the rows one gifts request
+	// returns; larger results are paged with offset.
+	ServeDefaultLimit = 1000
+	ServeMaxLimit     = 10000
+)
+
+// ServeHandler is a read-only JSON API over the stored collections:
+//
+//	GET /collections                  stats of every collection
+//	GET /collections/{gift}/gifts     rows filtered like query, paged with limit and offset
+//	GET /supply                       last observed supply of every collection
+func ServeHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /collections", func(w http.ResponseWriter, r *http.Request) {
+		keys, err := ResolveGifts(nil)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		stats, err := CollectStats(keys)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, stats)
+	})
+	mux.HandleFunc("GET /collections/{gift}/gifts", func(w http.ResponseWriter, r *http.Request) {
+		keys, err := ResolveGifts([]string{r.PathValue("gift")})
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		params := r.URL.Query()
+		limit, err := intParam(params, "limit", ServeDefaultLimit, 1, ServeMaxLimit)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		offset, err := intParam(params, "offset", 0, 0, math.MaxInt32)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		number, err := intParam(params, "number", 0, 0, math.MaxInt32)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		store, err := storage.Open(storage.Dir, parser.SanitizeKey(keys[0]))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		gifts, err := store.Query(NormalizeQuery(storage.Query{
+			Model:    params.Get("model"),
+			Backdrop: params.Get("backdrop"),
+			Symbol:   params.Get("symbol"),
+			Owner:    params.Get("owner"),
+			Number:   int32(number),
+		}))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		gifts = gifts[min(offset, len(gifts)):]
+		writeJSON(w, gifts[:min(limit, len(gifts))])
+	})
+	mux.HandleFunc("GET /supply", func(w http.ResponseWriter, r *http.Request) {
+		supply, err := parser.LoadSupply(parser.SupplyPath)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, supply)
+	})
+	return mux
+}
+
+// Serve runs ServeHandler on addr until ctx is cancelled.
+func Serve(ctx context.Context, addr string) error {
+	srv := &http.Server{Addr: addr, Handler: ServeHandler(), ReadHeaderTimeout: 10 * time.Second}
+	served := make(chan error, 1)
+	go func() { served <- srv.ListenAndServe() }()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return ctx.Err()
+}
+
+// intParam reads the query parameter name as an int in [lo, hi], or def when
+// it is missing.
+func intParam(params url.Values, name string, def, lo, hi int) (int, error) {
+	raw := params.Get(name)
+	if raw == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < lo || n > hi {
+		return 0, fmt.Errorf("%s must be a number from %d to %d", name, lo, hi)
+	}
+	return n, nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
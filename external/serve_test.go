@@ -0,0 +1,88 @@
+package external
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tg-gifts-parser/internal/parser"
+	"tg-gifts-parser/internal/storage"
+)
+
+func TestServeGifts(t *testing.T) {
+	dir := useTestDatabase(t)
+	prevCatalog := parser.CatalogPath
+	parser.CatalogPath = filepath.Join(dir, "gifts.json")
+	t.Cleanup(func() { parser.CatalogPath = prevCatalog })
+	if err := os.WriteFile(parser.CatalogPath, []byte(`{"Plush Pepe": [], "Swag Bag": []}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Swag Bag grows past the default page size.
+	store, err := storage.Open(storage.Dir, "SwagBag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := int32(2); n <= ServeDefaultLimit+10; n++ {
+		if err := store.Append(storage.Gift{Name: "Swag Bag", Number: n, Status: storage.StatusOK, Model: "Plain"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(ServeHandler())
+	defer srv.Close()
+
+	cases := []struct {
+		path   string
+		params url.Values
+		status int
+		rows   int
+		first  int32
+	}{
+		{"Plush Pepe", url.Values{"model": {"Cozy Galaxy (1.5%)"}}, http.StatusOK, 1, 1},
+		{"PlushPepe", url.Values{"owner": {"@pepe"}}, http.StatusOK, 1, 1},
+		{"PlushPepe", url.Values{"number": {"2"}}, http.StatusOK, 0, 0},
+		{"SwagBag", nil, http.StatusOK, ServeDefaultLimit, 1},
+		{"SwagBag", url.Values{"model": {"Plain"}, "limit": {"5"}, "offset": {"3"}}, http.StatusOK, 5, 5},
+		{"SwagBag", url.Values{"offset": {"1005"}}, http.StatusOK, 5, 1006},
+		{"SwagBag", url.Values{"offset": {"5000"}}, http.StatusOK, 0, 0},
+		{"SwagBag", url.Values{"limit": {"0"}}, http.StatusBadRequest, 0, 0},
+		{"SwagBag", url.Values{"limit": {"100000"}}, http.StatusBadRequest, 0, 0},
+		{"SwagBag", url.Values{"offset": {"-1"}}, http.StatusBadRequest, 0, 0},
+		{"SwagBag", url.Values{"number": {"x"}}, http.StatusBadRequest, 0, 0},
+		{"Missing Gift", nil, http.StatusNotFound, 0, 0},
+	}
+	for _, c := range cases {
+		u := srv.URL + "/collections/" + url.PathEscape(c.path) + "/gifts?" + c.params.Encode()
+		resp, err := http.Get(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var gifts []storage.Gift
+		if resp.StatusCode == http.StatusOK {
+			err = json.NewDecoder(resp.Body).Decode(&gifts)
+		}
+		resp.Body.Close()
+		if err != nil || resp.StatusCode != c.status {
+			t.Errorf("%s?%s: status %d, %v; want %d", c.path, c.params.Encode(), resp.StatusCode, err, c.status)
+			continue
+		}
+		if len(gifts) != c.rows || len(gifts) > 0 && gifts[0].Number != c.first {
+			t.Errorf("%s?%s: %d rows from #%d, want %d from #%d", c.path, c.params.Encode(), len(gifts), firstNumber(gifts), c.rows, c.first)
+		}
+	}
+}
+
+func firstNumber(gifts []storage.Gift) int32 {
+	if len(gifts) == 0 {
+		return 0
+	}
+	return gifts[0].Number
+}
@@ -0,0 +1,112 @@
+package external
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"tg-gifts-parser/internal/parser"
+	"tg-gifts-parser/internal/storage"
+)
+
+// CollectionStats summarises what is stored for one collection against the
+// last supply observed for it.
+type CollectionStats struct {
+	Name       string `json:"name"`
+	Slug       string `json:"slug"`
+	Rows       int    `json:"rows"`
+	OK         int    `json:"ok"`
+	Failed     int    `json:"failed"`
+	NotFound   int    `json:"not_found"`
+	Contiguous int    `json:"contiguous"`
+	Missing    int    `json:"missing"`
+	Duplicates int    `json:"duplicates"`
+	Issued     int    `json:"issued"`
+	Total      int    `json:"total"`
+}
+
+// Coverage is the share of issued numbers stored with real data.
+func (s CollectionStats) Coverage() float64 {
+	if s.Issued == 0 {
+		return 0
+	}
+	return float64(s.OK) / float64(s.Issued)
+}
+
+// ResolveGifts maps names or slugs given on the command line to catalog
+// keys. No names means every collection, sorted by name.
+func ResolveGifts(names []string) ([]string, error) {
+	keys, err := parser.LoadGiftsJSON(parser.CatalogPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load gifts JSON: %w", err)
+	}
+	sort.Strings(keys)
+	if len(names) == 0 {
+		return keys, nil
+	}
+
+	bySlug := make(map[string]string, len(keys))
+	for _, key := range keys {
+		bySlug[strings.ToLower(parser.SanitizeKey(key))] = key
+	}
+	resolved := make([]string, 0, len(names))
+	for _, name := range names {
+		key, ok := bySlug[strings.ToLower(parser.SanitizeKey(name))]
+		if !ok {
+			return nil, fmt.Errorf("unknown gift %q", name)
+		}
+		resolved = append(resolved, key)
+	}
+	return resolved, nil
+}
+
+func collectionStats(key string, supply parser.CollectionSupply) (CollectionStats, error) {
+	keySlug := parser.SanitizeKey(key)
+	stats := CollectionStats{Name: key, Slug: keySlug, Issued: supply.Issued, Total: supply.Total}
+
+	store, err := storage.Open(storage.Dir, keySlug)
+	if err != nil {
+		return stats, err
+	}
+	gifts, err := storage.ReadAll(store)
+	if err != nil {
+		return stats, fmt.Errorf("read %s: %w", keySlug, err)
+	}
+
+	stats.Rows = len(gifts)
+	for _, g := range gifts {
+		switch {
+		case g.Status == storage.StatusOK:
+			stats.OK++
+		case g.Status == storage.StatusNotFound:
+			stats.NotFound++
+		default:
+			stats.Failed++
+		}
+	}
+
+	numbers := storage.Numbers(gifts)
+	gaps := parser.FindGaps(numbers, max(parser.MaxNumber(numbers), supply.Issued))
+	stats.Contiguous = gaps.Contiguous
+	stats.Missing = len(gaps.Missing)
+	stats.Duplicates = len(gaps.Duplicates)
+	return stats, nil
+}
+
+// CollectStats reads the store of every key and pairs it with SupplyPath.
+func CollectStats(keys []string) ([]CollectionStats, error) {
+	supply, err := parser.LoadSupply(parser.SupplyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	all := make([]CollectionStats, 0, len(keys))
+	for _, key := range keys {
+		stats, err := collectionStats(key, supply[key])
+		if err != nil {
+			return all, err
+		}
+		all = append(all, stats)
+	}
+	return all, nil
+}
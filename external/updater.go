@@ -1,238 +1,146 @@
 package external
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"sync"
 	"time"
 
 	"tg-gifts-parser/internal/parser"
-
-	"github.com/xitongsys/parquet-go-source/local"
-	"github.com/xitongsys/parquet-go/reader"
-	"github.com/xitongsys/parquet-go/writer"
+	"tg-gifts-parser/internal/progress"
+	"tg-gifts-parser/internal/storage"
 )
 
-const (
-	dbFolder        = "data/database"
-	giftsJSONPath   = "data/gifts.json"
-	updateThreshold = 10000
+var (
+	// Workers is how many collections the updater, repair, refresh and
+	// reparse runs work on at once.
+	Workers = 5
+	// UpdateInterval is the pause between scheduled updater runs.
+	UpdateInterval = 6 * time.Hour
+	// UpdateThreshold is how many new rows the scheduled updater collects
+	// before committing and pushing the database.
+	UpdateThreshold = 10000
 )
 
-type Gift struct {
-	ID       int32  `parquet:"name=id, type=INT32"`
-	Name     string `parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8"`
-	Number   int32  `parquet:"name=number, type=INT32"`
-	Model    string `parquet:"name=model, type=BYTE_ARRAY, convertedtype=UTF8"`
-	Backdrop string `parquet:"name=backdrop, type=BYTE_ARRAY, convertedtype=UTF8"`
-	Symbol   string `parquet:"name=symbol, type=BYTE_ARRAY, convertedtype=UTF8"`
-}
-
-func ensureParquetFile(path string) error {
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		fw, err := local.NewLocalFileWriter(path)
-		if err != nil {
-			return err
-		}
-		defer fw.Close()
-
-		pw, err := writer.NewParquetWriter(fw, new(Gift), 1)
-		if err != nil {
-			return err
-		}
-		if err := pw.WriteStop(); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func getExistingCount(path string) (int, error) {
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return 0, nil
-	}
-	fr, err := local.NewLocalFileReader(path)
-	if err != nil {
-		return 0, err
-	}
-	defer fr.Close()
-
-	pr, err := reader.NewParquetReader(fr, new(Gift), 1)
-	if err != nil {
-		return 0, err
-	}
-	defer pr.ReadStop()
-
-	return int(pr.GetNumRows()), nil
-}
-
-func readAllGifts(path string) ([]Gift, error) {
-	fr, err := local.NewLocalFileReader(path)
-	if err != nil {
-		return nil, err
-	}
-	defer fr.Close()
-
-	pr, err := reader.NewParquetReader(fr, new(Gift), 1)
-	if err != nil {
-		return nil, err
-	}
-	defer pr.ReadStop()
+// forEachCollection runs fn for every key, Workers at a time, until ctx is
+// cancelled. It returns the sum of fn's counts and every error fn returned
+// joined with ctx.Err(), so cancellation is reported once.
+func forEachCollection(ctx context.Context, keys []string, fn func(key string) (int, error)) (int, error) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, Workers)
+	total := 0
+	var errs []error
 
-	num := int(pr.GetNumRows())
-	gifts := make([]Gift, num)
-	if num > 0 {
-		if err := pr.Read(&gifts); err != nil {
-			return nil, err
+	for _, key := range keys {
+		if !parser.Acquire(ctx, sem) {
+			break
 		}
+		wg.Add(1)
+		go func(k string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			count, err := fn(k)
+			mu.Lock()
+			total += count
+			if err != nil && !errors.Is(err, context.Canceled) {
+				errs = append(errs, err)
+			}
+			mu.Unlock()
+		}(key)
 	}
-	return gifts, nil
-}
-
-func writeAllGifts(path string, gifts []Gift) error {
-	fw, err := local.NewLocalFileWriter(path)
-	if err != nil {
-		return err
-	}
-	defer fw.Close()
+	wg.Wait()
 
-	pw, err := writer.NewParquetWriter(fw, new(Gift), 1)
-	if err != nil {
-		return err
-	}
-	for _, g := range gifts {
-		if err := pw.Write(g); err != nil {
-			return err
-		}
-	}
-	return pw.WriteStop()
+	return total, errors.Join(append(errs, ctx.Err())...)
 }
 
-func updateGiftIfNeeded(key string) (int, error) {
+func updateGiftIfNeeded(ctx context.Context, key string) (newItemsCount int, err error) {
 	keySlug := parser.SanitizeKey(key)
-	parquetPath := filepath.Join(dbFolder, keySlug+".parquet")
-
-	if err := ensureParquetFile(parquetPath); err != nil {
-		return 0, fmt.Errorf("ensure parquet file for %q: %w", key, err)
-	}
-
-	existingCount, err := getExistingCount(parquetPath)
-	if err != nil {
-		return 0, fmt.Errorf("failed to get existing count for %q: %w", key, err)
-	}
+	report := progress.Reporter{Op: "update", Gift: key, Slug: keySlug}
+	todo := 0
+	defer func() {
+		if todo > 0 || err != nil {
+			report.Finished(newItemsCount, todo, err)
+		}
+	}()
 
-	url := fmt.Sprintf("https://t.me/nft/%s-1", keySlug)
-	doc, err := parser.FetchHTML(url, 3, 2*time.Second)
+	plan, err := parser.PlanCollection(ctx, key, report)
 	if err != nil {
-		return 0, fmt.Errorf("failed to fetch first page for %q: %w", key, err)
-	}
-
-	quantityStr := parser.ExtractGiftField(doc, "Quantity")
-	if quantityStr == "Unknown" {
-		quantityStr = parser.ExtractQuantityFallback(doc)
+		return 0, err
 	}
-	quantity := parser.CleanQuantity(quantityStr)
-	if quantity == 0 {
-		fmt.Printf("Zero quantity found for %q\n", key)
+	todo = len(plan.Missing)
+	if todo == 0 {
 		return 0, nil
 	}
 
-	if existingCount >= quantity {
-		return 0, nil
-	}
+	report.Emit(progress.Event{Kind: progress.CollectionStarted, Quantity: plan.Quantity, Start: plan.Start, Total: todo})
 
-	allGifts, err := readAllGifts(parquetPath)
-	if err != nil {
-		return 0, fmt.Errorf("read gifts: %w", err)
-	}
-
-	newItemsCount := 0
-	for i := existingCount + 1; i <= quantity; i++ {
-		giftURL := fmt.Sprintf("https://t.me/nft/%s-%d", keySlug, i)
-		doc, err := parser.FetchHTML(giftURL, 3, 2*time.Second)
-		if err != nil {
-			fmt.Printf("Warning: failed to fetch %s: %v\n", giftURL, err)
-			continue
+	var aborted error
+	watch := parser.NewLayoutWatch(parser.LayoutWindow, parser.LayoutMinSamples, parser.LayoutMaxRate)
+	watch.Issued = plan.Quantity
+	writer := parser.NewCheckpointWriter(plan.Store.Flush, report)
+	for _, i := range plan.Missing {
+		doc, err := parser.FetchPage(ctx, keySlug, i)
+		if ctx.Err() != nil {
+			break
 		}
-
-		info := parser.ParseGiftInfo(doc)
-		newGift := Gift{
-			ID:       int32(i),
-			Name:     key,
-			Number:   int32(i),
-			Model:    info["Model"],
-			Backdrop: info["Backdrop"],
-			Symbol:   info["Symbol"],
+		report.Item(i, err)
+		gift := parser.BuildGift(key, i, doc, err)
+		if err := plan.Store.Append(gift); err != nil {
+			return newItemsCount, fmt.Errorf("store %s: %w", parser.PageKey(keySlug, i), err)
 		}
-		allGifts = append(allGifts, newGift)
 		newItemsCount++
-
-		if newItemsCount%1000 == 0 {
-			fmt.Printf("Parsed %q gift item #%d\n", key, i)
+		if aborted = watch.Observe(gift); aborted != nil {
+			break
 		}
+		writer.Wrote(1)
 	}
 
-	if err := writeAllGifts(parquetPath, allGifts); err != nil {
-		return 0, fmt.Errorf("write parquet: %w", err)
+	if err := writer.Close(); err != nil {
+		return 0, err
 	}
-
-	fmt.Printf("Updated gift %q with %d new items\n", key, newItemsCount)
-	return newItemsCount, nil
+	if aborted != nil {
+		return newItemsCount, aborted
+	}
+	return newItemsCount, ctx.Err()
 }
 
-func RunUpdater() (int, error) {
-	keys, err := parser.LoadGiftsJSON(giftsJSONPath)
+func RunUpdater(ctx context.Context) (int, error) {
+	keys, err := parser.LoadGiftsJSON(parser.CatalogPath)
 	if err != nil {
 		return 0, fmt.Errorf("failed to load gifts JSON: %w", err)
 	}
 
-	var mu sync.Mutex
-	var wg sync.WaitGroup
-	sem := make(chan struct{}, 5)
-	totalNewItems := 0
-
-	for _, key := range keys {
-		wg.Add(1)
-		sem <- struct{}{}
-		go func(k string) {
-			defer wg.Done()
-			defer func() { <-sem }()
-			count, err := updateGiftIfNeeded(k)
-			if err != nil {
-				fmt.Printf("Update error for %q: %v\n", k, err)
-				return
-			}
-			mu.Lock()
-			totalNewItems += count
-			mu.Unlock()
-		}(key)
-	}
-	wg.Wait()
-
-	fmt.Printf("Total new gifts added this run: %d\n", totalNewItems)
-	return totalNewItems, nil
+	totalNewItems, err := forEachCollection(ctx, keys, func(key string) (int, error) {
+		return updateGiftIfNeeded(ctx, key)
+	})
+	progress.Emit(progress.Event{Kind: progress.Totals, Op: "update", Count: totalNewItems, Total: len(keys), Error: progress.ErrText(err)})
+	return totalNewItems, err
 }
 
-func gitCommitAll(newItems int) error {
-	cmd := exec.Command("git", "add", dbFolder)
-	cmd.Stdout = os.Stdout
+// CommitDatabase commits the databases and supply file to git and pushes.
+// git's own output goes to stderr, as stdout carries the progress events.
+func CommitDatabase(newItems int) error {
+	cmd := exec.Command("git", "add", storage.Dir, parser.SupplyPath)
+	cmd.Stdout = os.Stderr
 	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("git add failed: %w", err)
 	}
 
-	commitMsg := fmt.Sprintf("chore(data/database/*.parquet): updated %d gifts", newItems)
+	commitMsg := fmt.Sprintf("chore(data/database/*%s): updated %d gifts", storage.Ext(storage.Backend), newItems)
 	cmd = exec.Command("git", "commit", "-m", commitMsg)
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = os.Stderr
 	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("git commit failed: %w", err)
 	}
 
 	cmd = exec.Command("git", "push")
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = os.Stderr
 	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("git push failed: %w", err)
@@ -240,28 +148,42 @@ func gitCommitAll(newItems int) error {
 	return nil
 }
 
-func ScheduleUpdater() {
+// ScheduleUpdater runs the updater every UpdateInterval until ctx is cancelled,
+// then returns ctx.Err().
+func ScheduleUpdater(ctx context.Context) error {
 	totalSinceLastCommit := 0
+	status := func(format string, a ...any) {
+		progress.Emit(progress.Event{Kind: progress.Info, Op: "daemon", Message: fmt.Sprintf(format, a...)})
+	}
+	warn := func(message string, err error) {
+		progress.Emit(progress.Event{Kind: progress.Warning, Op: "daemon", Message: message, Error: progress.ErrText(err)})
+	}
 
 	for {
-		fmt.Println("Running updater...")
-		newItems, err := RunUpdater()
+		status("Running updater...")
+		newItems, err := RunUpdater(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// One failing collection does not hold back what the others stored.
 		if err != nil {
-			fmt.Printf("Updater error: %v\n", err)
-		} else {
-			totalSinceLastCommit += newItems
-			if totalSinceLastCommit >= updateThreshold {
-				fmt.Println("Threshold reached, committing changes to GitHub...")
-				err := gitCommitAll(totalSinceLastCommit)
-				if err != nil {
-					fmt.Printf("Git commit failed: %v\n", err)
-				} else {
-					totalSinceLastCommit = 0
-				}
+			warn("updater failed", err)
+		}
+		totalSinceLastCommit += newItems
+		if totalSinceLastCommit >= UpdateThreshold {
+			status("Threshold reached, committing %d new rows...", totalSinceLastCommit)
+			if err := CommitDatabase(totalSinceLastCommit); err != nil {
+				warn("git commit failed", err)
+			} else {
+				totalSinceLastCommit = 0
 			}
 		}
 
-		fmt.Println("Sleeping for 6 hours...")
-		time.Sleep(6 * time.Hour)
+		status("Sleeping for %s...", UpdateInterval)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(UpdateInterval):
+		}
 	}
 }
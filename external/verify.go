@@ -0,0 +1,64 @@
+package external
+
+import (
+	"fmt"
+	"os"
+
+	"tg-gifts-parser/internal/parser"
+	"tg-gifts-parser/internal/storage"
+)
+
+// VerifyDatabases checks every stored collection: that it reads back, is in
+// the current schema, belongs to a catalog key and has no duplicate numbers.
+// Each problem found is one line of the result.
+func VerifyDatabases() ([]string, error) {
+	keys, err := parser.LoadGiftsJSON(parser.CatalogPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load gifts JSON: %w", err)
+	}
+	known := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		known[parser.SanitizeKey(key)] = true
+	}
+
+	slugs, err := storage.Slugs(storage.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	for _, slug := range slugs {
+		path := storage.Path(storage.Dir, slug)
+		if !known[slug] {
+			problems = append(problems, fmt.Sprintf("%s: not in %s", path, parser.CatalogPath))
+		}
+
+		store, err := storage.Open(storage.Dir, slug)
+		if err != nil {
+			return nil, err
+		}
+		version, err := store.SchemaVersion()
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: unreadable: %v", path, err))
+			continue
+		}
+		if version != storage.SchemaVersion {
+			problems = append(problems, fmt.Sprintf("%s: schema v%d, want v%d (run migrate)", path, version, storage.SchemaVersion))
+		}
+
+		gifts, err := storage.ReadAll(store)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: unreadable: %v", path, err))
+			continue
+		}
+		numbers := storage.Numbers(gifts)
+		if gaps := parser.FindGaps(numbers, parser.MaxNumber(numbers)); len(gaps.Duplicates) > 0 {
+			problems = append(problems, fmt.Sprintf("%s: %d duplicate numbers (run repair)", path, len(gaps.Duplicates)))
+		}
+	}
+
+	if _, err := os.Stat(storage.Dir); os.IsNotExist(err) {
+		problems = append(problems, fmt.Sprintf("%s: database directory missing", storage.Dir))
+	}
+	return problems, nil
+}
@@ -0,0 +1,321 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"tg-gifts-parser/internal/parser"
+	"tg-gifts-parser/internal/progress"
+	"tg-gifts-parser/internal/storage"
+)
+
+// Coordinator hands out ranges of numbers to workers and merges the segments
+// they send back into the collection stores.
+type Coordinator struct {
+	Dir   string
+	Token string
+	// LeaseTTL is how long a worker may go without a heartbeat before its
+	// range is handed to someone else.
+	LeaseTTL time.Duration
+
+	mu      sync.Mutex
+	pending []Range
+	leases  map[string]*Lease
+	nextID  int
+	stores  map[string]storage.GiftStore
+	open    map[string]int
+	merged  map[string]int
+	total   int
+	done    chan struct{}
+}
+
+func NewCoordinator(dir, token string, ranges []Range) *Coordinator {
+	c := &Coordinator{
+		Dir:      dir,
+		Token:    token,
+		LeaseTTL: LeaseTTL,
+		pending:  ranges,
+		leases:   make(map[string]*Lease),
+		stores:   make(map[string]storage.GiftStore),
+		open:     make(map[string]int),
+		merged:   make(map[string]int),
+		done:     make(chan struct{}),
+	}
+	for _, r := range ranges {
+		c.open[r.Slug]++
+	}
+	if len(ranges) == 0 {
+		close(c.done)
+	}
+	return c
+}
+
+// PlanRanges splits every collection into ranges of at most size numbers,
+// starting after the numbers already stored in dir.
+func PlanRanges(ctx context.Context, dir string, keys []string, size int) ([]Range, error) {
+	var ranges []Range
+	for _, key := range keys {
+		keySlug := parser.SanitizeKey(key)
+		report := progress.Reporter{Op: "plan", Gift: key, Slug: keySlug}
+
+		supply, err := parser.FetchSupply(ctx, key, report)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			report.Warn("skipping collection", err)
+			continue
+		}
+
+		store, err := storage.Open(dir, keySlug)
+		if err != nil {
+			return nil, fmt.Errorf("open store for %q: %w", key, err)
+		}
+		existing, err := storage.ReadAll(store)
+		if err != nil {
+			return nil, fmt.Errorf("read %q: %w", key, err)
+		}
+
+		start := parser.FindGaps(storage.Numbers(existing), supply.Issued).Contiguous + 1
+		for from := start; from <= supply.Issued; from += size {
+			to := min(from+size-1, supply.Issued)
+			ranges = append(ranges, Range{Gift: key, Slug: keySlug, From: from, To: to})
+		}
+	}
+	return ranges, nil
+}
+
+func (c *Coordinator) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /lease", c.handleLease)
+	mux.HandleFunc("POST /heartbeat", c.handleHeartbeat)
+	mux.HandleFunc("POST /segment", c.handleSegment)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r, c.Token) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// Run serves workers on addr until every range is merged or ctx is done,
+// and returns the number of rows merged. Without a token addr must be a
+// loopback address.
+func (c *Coordinator) Run(ctx context.Context, addr string) (int, error) {
+	if err := CheckListenToken(addr, c.Token); err != nil {
+		return 0, err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return 0, err
+	}
+	srv := &http.Server{Handler: c.Handler()}
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(ln) }()
+
+	progress.Emit(progress.Event{Kind: progress.CollectionStarted, Op: "coordinator", Total: len(c.pending), Message: "listening on " + ln.Addr().String()})
+
+	ticker := time.NewTicker(c.LeaseTTL / 4)
+	defer ticker.Stop()
+
+	var runErr error
+loop:
+	for {
+		select {
+		case <-c.done:
+			// Keep answering 410 for a poll interval so idle workers
+			// learn the run is over instead of finding the port closed.
+			select {
+			case <-ctx.Done():
+			case <-time.After(PollInterval + time.Second):
+			}
+			break loop
+		case <-ctx.Done():
+			runErr = ctx.Err()
+			break loop
+		case err := <-served:
+			return c.mergedTotal(), err
+		case <-ticker.C:
+			c.reap()
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	srv.Shutdown(shutdownCtx)
+
+	total := c.mergedTotal()
+	progress.Emit(progress.Event{Kind: progress.Totals, Op: "coordinator", Count: total, Total: len(c.merged), Error: progress.ErrText(runErr)})
+	return total, runErr
+}
+
+func (c *Coordinator) mergedTotal() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.total
+}
+
+// reap puts the ranges of leases that missed their heartbeat back in the
+// queue. The caller must not hold c.mu.
+func (c *Coordinator) reap() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reapLocked()
+}
+
+func (c *Coordinator) reapLocked() {
+	now := time.Now()
+	for id, l := range c.leases {
+		if now.After(l.Expires) {
+			delete(c.leases, id)
+			c.pending = append(c.pending, l.Range)
+			progress.Emit(progress.Event{Kind: progress.Warning, Op: "coordinator", Gift: l.Gift, Slug: l.Slug, Message: fmt.Sprintf("worker %s went silent, requeued #%d-#%d", l.Worker, l.From, l.To)})
+		}
+	}
+}
+
+func (c *Coordinator) handleLease(w http.ResponseWriter, r *http.Request) {
+	var req leaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	c.reapLocked()
+	if len(c.pending) == 0 {
+		finished := len(c.leases) == 0
+		c.mu.Unlock()
+		if finished {
+			w.WriteHeader(http.StatusGone)
+		} else {
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return
+	}
+
+	rng := c.pending[0]
+	c.pending = c.pending[1:]
+	c.nextID++
+	lease := &Lease{ID: strconv.Itoa(c.nextID), Worker: req.Worker, Expires: time.Now().Add(c.LeaseTTL), TTL: c.LeaseTTL, Range: rng}
+	c.leases[lease.ID] = lease
+	c.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lease)
+}
+
+func (c *Coordinator) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	lease, ok := c.leases[r.URL.Query().Get("lease")]
+	if !ok {
+		http.Error(w, "lease expired", http.StatusConflict)
+		return
+	}
+	lease.Expires = time.Now().Add(c.LeaseTTL)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Coordinator) handleSegment(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("lease")
+	done, err := strconv.Atoi(r.URL.Query().Get("done"))
+	if err != nil {
+		http.Error(w, "bad done number", http.StatusBadRequest)
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxSegmentBytes+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(data) > maxSegmentBytes {
+		http.Error(w, "segment too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	c.mu.Lock()
+	lease, ok := c.leases[id]
+	c.mu.Unlock()
+	if !ok {
+		http.Error(w, "lease expired", http.StatusConflict)
+		return
+	}
+
+	count, err := c.merge(lease, done, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	progress.Emit(progress.Event{Kind: progress.SegmentMerged, Op: "coordinator", Gift: lease.Gift, Slug: lease.Slug, Number: done, Count: count, Message: "segment from " + lease.Worker})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// merge checks a segment against its lease and writes it to the store.
+func (c *Coordinator) merge(lease *Lease, done int, data []byte) (int, error) {
+	if done < lease.From-1 || done > lease.To {
+		return 0, fmt.Errorf("done number %d outside #%d-#%d", done, lease.From, lease.To)
+	}
+
+	gifts := []storage.Gift{}
+	if len(data) > 0 {
+		var err error
+		if gifts, err = storage.ReadSegment(data); err != nil {
+			return 0, fmt.Errorf("decode segment: %w", err)
+		}
+	}
+	for _, g := range gifts {
+		if g.Name != lease.Gift || int(g.Number) < lease.From || int(g.Number) > done {
+			return 0, fmt.Errorf("row %s #%d does not belong to lease %s", g.Name, g.Number, lease.ID)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// The lease may have expired while the segment was decoded.
+	if c.leases[lease.ID] != lease {
+		return 0, errors.New("lease expired")
+	}
+
+	store, ok := c.stores[lease.Slug]
+	if !ok {
+		var err error
+		if store, err = storage.Open(c.Dir, lease.Slug); err != nil {
+			return 0, err
+		}
+		c.stores[lease.Slug] = store
+	}
+	if err := store.Replace(gifts...); err != nil {
+		return 0, err
+	}
+	if err := store.Flush(); err != nil {
+		return 0, err
+	}
+
+	delete(c.leases, lease.ID)
+	c.total += len(gifts)
+	c.merged[lease.Slug] += len(gifts)
+	if done < lease.To {
+		rest := lease.Range
+		rest.From = done + 1
+		c.pending = append(c.pending, rest)
+	} else if c.open[lease.Slug]--; c.open[lease.Slug] == 0 {
+		progress.Emit(progress.Event{Kind: progress.CollectionFinished, Op: "coordinator", Gift: lease.Gift, Slug: lease.Slug, Count: c.merged[lease.Slug], Total: c.merged[lease.Slug]})
+	}
+
+	if len(c.pending) == 0 && len(c.leases) == 0 {
+		close(c.done)
+	}
+	return len(gifts), nil
+}
@@ -0,0 +1,66 @@
+package cluster
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The coordinator and its workers talk JSON over plain HTTP:
+//
+//	POST /lease               -> 200 Lease, 204 while other leases are open, 410 when done
+//	POST /heartbeat?lease=ID  -> 204, or 409 once the lease was given to someone else
+//	POST /segment?lease=ID&done=N
+//	                          -> 204; body is a parquet segment of the numbers
+//	                             From..N, and N < To puts the rest back in the queue
+const (
+	DefaultAddr  = ":8700"
+	RangeSize    = 1000
+	LeaseTTL     = 2 * time.Minute
+	PollInterval = 10 * time.Second
+
+	maxSegmentBytes = 256 << 20
+)
+
+// Range is a span of numbers of one collection, both ends inclusive.
+type Range struct {
+	Gift string `json:"gift"`
+	Slug string `json:"slug"`
+	From int    `json:"from"`
+	To   int    `json:"to"`
+}
+
+type Lease struct {
+	ID      string    `json:"id"`
+	Worker  string    `json:"worker"`
+	Expires time.Time `json:"expires"`
+	// TTL lets workers pace heartbeats without trusting their own clock.
+	TTL time.Duration `json:"ttl"`
+	Range
+}
+
+type leaseRequest struct {
+	Worker string `json:"worker"`
+}
+
+// CheckListenToken refuses to serve without a token on anything but a
+// loopback address, since whoever reaches the port could upload segments.
+func CheckListenToken(addr, token string) error {
+	if token != "" {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return nil
+	}
+	return fmt.Errorf("refusing to listen on %s without a token; set CLUSTER_TOKEN or listen on 127.0.0.1", addr)
+}
+
+func authorized(r *http.Request, token string) bool {
+	return token == "" || strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") == token
+}
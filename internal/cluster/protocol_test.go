@@ -0,0 +1,24 @@
+package cluster
+
+import "testing"
+
+func TestCheckListenToken(t *testing.T) {
+	cases := []struct {
+		addr, token string
+		ok          bool
+	}{
+		{":8700", "", false},
+		{"0.0.0.0:8700", "", false},
+		{"192.168.1.5:8700", "", false},
+		{"[::]:8700", "", false},
+		{":8700", "secret", true},
+		{"127.0.0.1:8700", "", true},
+		{"localhost:8700", "", true},
+		{"[::1]:8700", "", true},
+	}
+	for _, c := range cases {
+		if err := CheckListenToken(c.addr, c.token); (err == nil) != c.ok {
+			t.Errorf("CheckListenToken(%q, %q) = %v", c.addr, c.token, err)
+		}
+	}
+}
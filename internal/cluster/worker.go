@@ -0,0 +1,262 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"tg-gifts-parser/internal/parser"
+	"tg-gifts-parser/internal/progress"
+	"tg-gifts-parser/internal/storage"
+)
+
+const maxCoordinatorFailures = 10
+
+var (
+	errLeaseLost    = errors.New("lease lost")
+	errUnauthorized = errors.New("coordinator rejected the token")
+)
+
+// Worker leases ranges from a coordinator, scrapes them through the current
+// page source and uploads each one as a parquet segment.
+type Worker struct {
+	Coordinator string
+	ID          string
+	Token       string
+	Client      *http.Client
+	// Slots is how many leases the worker scrapes at once.
+	Slots int
+}
+
+func NewWorker(coordinator, token string) *Worker {
+	host, _ := os.Hostname()
+	return &Worker{
+		Coordinator: strings.TrimRight(coordinator, "/"),
+		ID:          fmt.Sprintf("%s-%d", host, os.Getpid()),
+		Token:       token,
+		Client:      &http.Client{Timeout: time.Minute},
+		Slots:       1,
+	}
+}
+
+func (w *Worker) post(ctx context.Context, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.Coordinator+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if w.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+w.Token)
+	}
+	return w.Client.Do(req)
+}
+
+// lease asks for work. It returns nil with finished set once the
+// coordinator has nothing left, and nil alone when it should ask again later.
+func (w *Worker) lease(ctx context.Context) (lease *Lease, finished bool, err error) {
+	body, _ := json.Marshal(leaseRequest{Worker: w.ID})
+	resp, err := w.post(ctx, "/lease", bytes.NewReader(body))
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		lease = new(Lease)
+		return lease, false, json.NewDecoder(resp.Body).Decode(lease)
+	case http.StatusNoContent:
+		return nil, false, nil
+	case http.StatusGone:
+		return nil, true, nil
+	case http.StatusUnauthorized:
+		return nil, false, errUnauthorized
+	default:
+		msg, _ := io.ReadAll(resp.Body)
+		return nil, false, fmt.Errorf("lease: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+}
+
+// heartbeat keeps lease alive until ctx ends and calls lost if the
+// coordinator has given the range to someone else.
+func (w *Worker) heartbeat(ctx context.Context, lease *Lease, lost func()) {
+	interval := lease.TTL / 3
+	if interval <= 0 {
+		interval = LeaseTTL / 3
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			resp, err := w.post(ctx, "/heartbeat?lease="+lease.ID, nil)
+			if err != nil {
+				continue
+			}
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusConflict {
+				lost()
+				return
+			}
+		}
+	}
+}
+
+func (w *Worker) upload(ctx context.Context, lease *Lease, done int, gifts []storage.Gift) error {
+	var buf bytes.Buffer
+	if len(gifts) > 0 {
+		if err := storage.WriteSegment(&buf, gifts); err != nil {
+			return err
+		}
+	}
+
+	resp, err := w.post(ctx, fmt.Sprintf("/segment?lease=%s&done=%d", lease.ID, done), &buf)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return nil
+	case http.StatusConflict:
+		return errLeaseLost
+	default:
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("segment: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+}
+
+// scrape fetches lease.From..lease.To and returns the rows together with the
+// last number it got to, which is short of lease.To when it stopped early.
+func (w *Worker) scrape(ctx context.Context, lease *Lease) ([]storage.Gift, int, error) {
+	report := progress.Reporter{Op: "worker", Gift: lease.Gift, Slug: lease.Slug}
+	report.Emit(progress.Event{Kind: progress.CollectionStarted, Start: lease.From, Total: lease.To - lease.From + 1, Message: "lease " + lease.ID})
+
+	var gifts []storage.Gift
+	watch := parser.NewLayoutWatch(parser.LayoutWindow, parser.LayoutMinSamples, parser.LayoutMaxRate)
+	for n := lease.From; n <= lease.To; n++ {
+		doc, err := parser.FetchPage(ctx, lease.Slug, n)
+		if ctx.Err() != nil {
+			return gifts, n - 1, ctx.Err()
+		}
+		report.Item(n, err)
+		gift := parser.BuildGift(lease.Gift, n, doc, err)
+		gifts = append(gifts, gift)
+		if err := watch.Observe(gift); err != nil {
+			return gifts, n, err
+		}
+	}
+	return gifts, lease.To, nil
+}
+
+// Run works until the coordinator runs out of ranges or ctx is cancelled,
+// and returns the number of rows uploaded. On cancellation the ranges in
+// progress are uploaded up to where they got.
+func (w *Worker) Run(ctx context.Context) (int, error) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var firstErr error
+	total := 0
+	gifts := make(map[string]bool)
+	seen := func(slug string) {
+		mu.Lock()
+		gifts[slug] = true
+		mu.Unlock()
+	}
+
+	for range max(w.Slots, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			count, err := w.loop(ctx, seen)
+			mu.Lock()
+			total += count
+			if firstErr == nil {
+				firstErr = err
+			}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	progress.Emit(progress.Event{Kind: progress.Totals, Op: "worker", Count: total, Total: len(gifts), Error: progress.ErrText(firstErr)})
+	return total, firstErr
+}
+
+func (w *Worker) loop(ctx context.Context, seen func(slug string)) (int, error) {
+	uploaded := 0
+	failures := 0
+	for {
+		lease, finished, err := w.lease(ctx)
+		if ctx.Err() != nil {
+			return uploaded, ctx.Err()
+		}
+		if errors.Is(err, errUnauthorized) {
+			return uploaded, err
+		}
+		if err != nil {
+			if failures++; failures >= maxCoordinatorFailures {
+				return uploaded, err
+			}
+			progress.Emit(progress.Event{Kind: progress.Warning, Op: "worker", Gift: w.Coordinator, Message: "coordinator unreachable", Error: err.Error()})
+		} else {
+			failures = 0
+		}
+		if finished {
+			return uploaded, nil
+		}
+		if lease == nil {
+			select {
+			case <-ctx.Done():
+				return uploaded, ctx.Err()
+			case <-time.After(PollInterval):
+			}
+			continue
+		}
+
+		seen(lease.Slug)
+		leaseCtx, cancelLease := context.WithCancelCause(ctx)
+		go w.heartbeat(leaseCtx, lease, func() { cancelLease(errLeaseLost) })
+		gifts, done, scrapeErr := w.scrape(leaseCtx, lease)
+		lost := errors.Is(context.Cause(leaseCtx), errLeaseLost)
+		cancelLease(nil)
+
+		report := progress.Reporter{Op: "worker", Gift: lease.Gift, Slug: lease.Slug}
+		if lost {
+			report.Finished(0, len(gifts), errLeaseLost)
+			continue
+		}
+
+		// Upload with a fresh context so an interrupted range still
+		// reaches the coordinator.
+		uploadCtx, cancelUpload := context.WithTimeout(context.Background(), time.Minute)
+		err = w.upload(uploadCtx, lease, done, gifts)
+		cancelUpload()
+		if err != nil {
+			report.Finished(0, len(gifts), err)
+		} else {
+			uploaded += len(gifts)
+			report.Finished(len(gifts), lease.To-lease.From+1, scrapeErr)
+		}
+
+		if ctx.Err() != nil {
+			return uploaded, ctx.Err()
+		}
+		// A layout change breaks every range alike, so stop instead of
+		// burning through the queue.
+		if errors.Is(scrapeErr, parser.ErrLayoutChanged) {
+			return uploaded, scrapeErr
+		}
+	}
+}
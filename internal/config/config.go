@@ -0,0 +1,301 @@
+// Package config loads the settings shared by every mode: worker counts,
+// retry and rate limits, updater schedule, endpoints and data paths.
+//
+// Values are layered: built-in defaults, then the TOML file, then
+// environment variables, then command-line flags.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"tg-gifts-parser/internal/cluster"
+	"tg-gifts-parser/internal/parser"
+	"tg-gifts-parser/internal/storage"
+
+	"github.com/BurntSushi/toml"
+)
+
+// DefaultPath is read when neither -config nor GIFTS_CONFIG names a file.
+// It is fine for it not to exist.
+const DefaultPath = "config.toml"
+
+type Config struct {
+	// DataDir is the parent of every path in Paths that is left empty.
+	DataDir  string   `toml:"data_dir"`
+	Scraper  Scraper  `toml:"scraper"`
+	Updater  Updater  `toml:"updater"`
+	Paths    Paths    `toml:"paths"`
+	Storage  Storage  `toml:"storage"`
+	Progress Progress `toml:"progress"`
+	Cluster  Cluster  `toml:"cluster"`
+}
+
+type Scraper struct {
+	Workers    int           `toml:"workers"`
+	BaseURL    string        `toml:"base_url"`
+	UserAgent  string        `toml:"user_agent"`
+	Attempts   int           `toml:"attempts"`
+	RetryDelay time.Duration `toml:"retry_delay"`
+	RateLimit  float64       `toml:"rate_limit"`
+	RateBurst  int           `toml:"rate_burst"`
+	// ProxyList and Archive are optional; empty disables them.
+	ProxyList string `toml:"proxy_list"`
+	Archive   string `toml:"archive"`
+	// PageDir, when set, serves pages from saved <slug>-<number>.html files
+	// instead of fetching them, for machines without network access.
+	PageDir string `toml:"page_dir"`
+}
+
+type Updater struct {
+	Workers   int           `toml:"workers"`
+	Interval  time.Duration `toml:"interval"`
+	Threshold int           `toml:"threshold"`
+}
+
+type Paths struct {
+	Database   string `toml:"database"`
+	Catalog    string `toml:"catalog"`
+	Base       string `toml:"base"`
+	Supply     string `toml:"supply"`
+	Candidates string `toml:"candidates"`
+	Changes    string `toml:"changes"`
+}
+
+type Storage struct {
+	// Backend is parquet (one file per collection, rewritten on every
+	// flush) or sqlite (one indexed database per collection).
+	Backend string `toml:"backend"`
+}
+
+type Progress struct {
+	Format string `toml:"format"`
+	Log    string `toml:"log"`
+}
+
+type Cluster struct {
+	Addr  string `toml:"addr"`
+	Token string `toml:"token"`
+}
+
+// Default returns the settings the tool used before it had a config file.
+func Default() Config {
+	transport := parser.RetryPolicies[parser.ErrTransport]
+	return Config{
+		DataDir: "data",
+		Scraper: Scraper{
+			Workers:    10,
+			BaseURL:    parser.DefaultBaseURL,
+			Attempts:   transport.Attempts,
+			RetryDelay: transport.Delay,
+			RateLimit:  parser.DefaultRequestsPerSecond,
+			RateBurst:  parser.DefaultBurst,
+		},
+		Updater: Updater{
+			Workers:   5,
+			Interval:  6 * time.Hour,
+			Threshold: 10000,
+		},
+		Storage:  Storage{Backend: storage.BackendParquet},
+		Progress: Progress{Format: "text"},
+		Cluster:  Cluster{Addr: cluster.DefaultAddr},
+	}
+}
+
+// setting ties one field to its flag name and environment variable. Flag
+// names must not clash with the mode arguments that follow them.
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	ptr   any
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{"data-dir", "GIFTS_DATA_DIR", "directory holding the catalog and database", &c.DataDir},
+		{"workers", "GIFTS_WORKERS", "pages the scraper fetches at once", &c.Scraper.Workers},
+		{"base-url", "GIFTS_BASE_URL", "gift page base URL", &c.Scraper.BaseURL},
+		{"user-agent", "GIFTS_USER_AGENT", "User-Agent header for page requests", &c.Scraper.UserAgent},
+		{"attempts", "GIFTS_ATTEMPTS", "attempts per page on transport errors", &c.Scraper.Attempts},
+		{"retry-delay", "GIFTS_RETRY_DELAY", "base delay between attempts", &c.Scraper.RetryDelay},
+		{"rate-limit", "GIFTS_RATE_LIMIT", "requests per second per host", &c.Scraper.RateLimit},
+		{"rate-burst", "GIFTS_RATE_BURST", "request burst per host", &c.Scraper.RateBurst},
+		{"proxy-list", "PROXY_LIST", "file with one proxy URL per line", &c.Scraper.ProxyList},
+		{"archive", "PAGE_ARCHIVE", "directory to archive fetched pages in", &c.Scraper.Archive},
+		{"page-dir", "GIFTS_PAGE_DIR", "read pages from <slug>-<number>.html files here instead of fetching", &c.Scraper.PageDir},
+		{"update-workers", "GIFTS_UPDATE_WORKERS", "collections updated at once", &c.Updater.Workers},
+		{"update-interval", "GIFTS_UPDATE_INTERVAL", "pause between scheduled updates", &c.Updater.Interval},
+		{"update-threshold", "GIFTS_UPDATE_THRESHOLD", "new rows before the updater commits", &c.Updater.Threshold},
+		{"database-dir", "GIFTS_DATABASE", "collection store directory (default <data-dir>/database)", &c.Paths.Database},
+		{"catalog-path", "GIFTS_CATALOG", "gifts.json path (default <data-dir>/gifts.json)", &c.Paths.Catalog},
+		{"base-path", "GIFTS_BASE", "base.json path (default <data-dir>/base.json)", &c.Paths.Base},
+		{"supply-path", "GIFTS_SUPPLY", "supply.json path (default <data-dir>/supply.json)", &c.Paths.Supply},
+		{"candidates-path", "GIFTS_CANDIDATES", "discovery candidates (default <data-dir>/candidates.txt)", &c.Paths.Candidates},
+		{"changes-path", "GIFTS_CHANGES", "refresh change log (default <data-dir>/changes.jsonl)", &c.Paths.Changes},
+		{"storage", "GIFTS_STORAGE", "collection store format: parquet or sqlite", &c.Storage.Backend},
+		{"progress", "PROGRESS_FORMAT", "progress output: text or json", &c.Progress.Format},
+		{"progress-log", "PROGRESS_LOG", "file to append JSON progress events to", &c.Progress.Log},
+		{"cluster-addr", "CLUSTER_ADDR", "coordinator listen address", &c.Cluster.Addr},
+		{"cluster-token", "CLUSTER_TOKEN", "shared coordinator/worker token", &c.Cluster.Token},
+	}
+}
+
+func (c *Config) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("tg-gifts-parser", flag.ContinueOnError)
+	fs.String("config", "", "TOML config file (default "+DefaultPath+", env GIFTS_CONFIG)")
+	for _, s := range c.settings() {
+		usage := s.usage + " (env " + s.env + ")"
+		switch p := s.ptr.(type) {
+		case *string:
+			fs.StringVar(p, s.flag, *p, usage)
+		case *int:
+			fs.IntVar(p, s.flag, *p, usage)
+		case *float64:
+			fs.Float64Var(p, s.flag, *p, usage)
+		case *time.Duration:
+			fs.DurationVar(p, s.flag, *p, usage)
+		}
+	}
+	return fs
+}
+
+// Load builds the config from the file, environment and the leading flags
+// of args, and returns the arguments after those flags.
+func Load(args []string) (Config, []string, error) {
+	flags, rest := splitFlags(args)
+
+	cfg := Default()
+	path, explicit := os.Getenv("GIFTS_CONFIG"), false
+	if path != "" {
+		explicit = true
+	}
+	if v, ok := flagValue(flags, "config"); ok {
+		path, explicit = v, true
+	}
+	if path == "" {
+		path = DefaultPath
+	}
+	if err := cfg.readFile(path, explicit); err != nil {
+		return cfg, rest, err
+	}
+
+	fs := cfg.flagSet()
+	for _, s := range cfg.settings() {
+		if v, ok := os.LookupEnv(s.env); ok && v != "" {
+			if err := fs.Set(s.flag, v); err != nil {
+				return cfg, rest, fmt.Errorf("%s: %w", s.env, err)
+			}
+		}
+	}
+	if err := fs.Parse(flags); err != nil {
+		return cfg, rest, err
+	}
+
+	cfg.resolvePaths()
+	return cfg, rest, cfg.validate()
+}
+
+func (c *Config) readFile(path string, explicit bool) error {
+	md, err := toml.DecodeFile(path, c)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return fmt.Errorf("unknown key %q in %s", undecoded[0].String(), path)
+	}
+	return nil
+}
+
+func (c *Config) resolvePaths() {
+	under := func(p *string, name string) {
+		if *p == "" {
+			*p = filepath.Join(c.DataDir, name)
+		}
+	}
+	under(&c.Paths.Database, "database")
+	under(&c.Paths.Catalog, "gifts.json")
+	under(&c.Paths.Base, "base.json")
+	under(&c.Paths.Supply, "supply.json")
+	under(&c.Paths.Candidates, "candidates.txt")
+	under(&c.Paths.Changes, "changes.jsonl")
+}
+
+func (c *Config) validate() error {
+	switch {
+	case c.Scraper.Workers < 1:
+		return fmt.Errorf("scraper.workers must be at least 1, got %d", c.Scraper.Workers)
+	case c.Scraper.Attempts < 1:
+		return fmt.Errorf("scraper.attempts must be at least 1, got %d", c.Scraper.Attempts)
+	case c.Scraper.RateLimit <= 0 || c.Scraper.RateBurst < 1:
+		return fmt.Errorf("scraper.rate_limit and rate_burst must be positive")
+	case c.Updater.Workers < 1:
+		return fmt.Errorf("updater.workers must be at least 1, got %d", c.Updater.Workers)
+	case c.Updater.Interval <= 0:
+		return fmt.Errorf("updater.interval must be positive, got %s", c.Updater.Interval)
+	case c.Updater.Threshold < 1:
+		return fmt.Errorf("updater.threshold must be at least 1, got %d", c.Updater.Threshold)
+	case !slices.Contains(storage.Backends, c.Storage.Backend):
+		return fmt.Errorf("storage.backend must be one of %s, got %q", strings.Join(storage.Backends, ", "), c.Storage.Backend)
+	case c.Progress.Format != "text" && c.Progress.Format != "json":
+		return fmt.Errorf("progress.format must be text or json, got %q", c.Progress.Format)
+	}
+	return nil
+}
+
+// PrintFlags writes the config flags and their defaults to w, for help
+// output.
+func PrintFlags(w io.Writer) {
+	cfg := Default()
+	fs := cfg.flagSet()
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+}
+
+// splitFlags separates the leading config flags from the mode and its
+// arguments, which start at the first argument that is not a config flag.
+func splitFlags(args []string) (flags, rest []string) {
+	cfg := Default()
+	fs := cfg.flagSet()
+	i := 0
+	for i < len(args) {
+		if !strings.HasPrefix(args[i], "-") {
+			break
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if fs.Lookup(name) == nil {
+			break
+		}
+		i++
+		if !hasValue && i < len(args) {
+			i++
+		}
+	}
+	return args[:i], args[i:]
+}
+
+func flagValue(flags []string, name string) (string, bool) {
+	for i := 0; i < len(flags); i++ {
+		key, value, hasValue := strings.Cut(strings.TrimLeft(flags[i], "-"), "=")
+		if key != name {
+			continue
+		}
+		if hasValue {
+			return value, true
+		}
+		if i+1 < len(flags) {
+			return flags[i+1], true
+		}
+	}
+	return "", false
+}
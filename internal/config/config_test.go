@@ -0,0 +1,159 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearEnv hides every config variable set in the environment running the
+// tests.
+func clearEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv("GIFTS_CONFIG", "")
+	cfg := Default()
+	for _, s := range cfg.settings() {
+		t.Setenv(s.env, "")
+	}
+}
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	clearEnv(t)
+	t.Chdir(t.TempDir())
+
+	cfg, rest, err := Load([]string{"scrape", "Plush Pepe"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rest, []string{"scrape", "Plush Pepe"}) {
+		t.Fatalf("rest = %q", rest)
+	}
+	want := Default()
+	want.resolvePaths()
+	if !reflect.DeepEqual(cfg, want) {
+		t.Fatalf("Load = %+v, want the defaults %+v", cfg, want)
+	}
+	if cfg.Paths.Database != filepath.Join("data", "database") {
+		t.Fatalf("database path %q", cfg.Paths.Database)
+	}
+}
+
+func TestLoadLayers(t *testing.T) {
+	clearEnv(t)
+	path := writeConfig(t, `
+data_dir = "/srv/gifts"
+
+[scraper]
+workers = 20
+rate_limit = 2.5
+
+[updater]
+interval = "1h"
+
+[paths]
+catalog = "/etc/gifts.json"
+`)
+
+	cases := []struct {
+		name    string
+		env     map[string]string
+		args    []string
+		workers int
+		rate    float64
+	}{
+		{"file over defaults", nil, nil, 20, 2.5},
+		{"env over file", map[string]string{"GIFTS_WORKERS": "30"}, nil, 30, 2.5},
+		{"flags over env", map[string]string{"GIFTS_WORKERS": "30", "GIFTS_RATE_LIMIT": "4"}, []string{"-workers", "40"}, 40, 4},
+		{"flag with =", nil, []string{"-rate-limit=8"}, 20, 8},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			for k, v := range c.env {
+				t.Setenv(k, v)
+			}
+			args := append([]string{"-config", path}, c.args...)
+			cfg, rest, err := Load(append(args, "repair", "-x"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(rest, []string{"repair", "-x"}) {
+				t.Errorf("rest = %q", rest)
+			}
+			if cfg.Scraper.Workers != c.workers || cfg.Scraper.RateLimit != c.rate {
+				t.Errorf("workers %d, rate %v; want %d, %v", cfg.Scraper.Workers, cfg.Scraper.RateLimit, c.workers, c.rate)
+			}
+			// Untouched keys keep their defaults, paths follow data_dir.
+			if cfg.Updater.Interval != time.Hour || cfg.Updater.Workers != Default().Updater.Workers {
+				t.Errorf("updater %+v", cfg.Updater)
+			}
+			if cfg.Paths.Database != filepath.Join("/srv/gifts", "database") || cfg.Paths.Catalog != "/etc/gifts.json" {
+				t.Errorf("paths %+v", cfg.Paths)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("GIFTS_CONFIG", writeConfig(t, "[updater]\nthreshold = 5\n"))
+	cfg, _, err := Load(nil)
+	if err != nil || cfg.Updater.Threshold != 5 {
+		t.Fatalf("Load = %+v, %v", cfg.Updater, err)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	clearEnv(t)
+	t.Chdir(t.TempDir())
+
+	cases := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{"unknown key", "[scraper]\nworkerz = 3\n", nil, nil, `unknown key "scraper.workerz"`},
+		{"unknown section", "[scrapper]\nworkers = 3\n", nil, nil, "unknown key"},
+		{"bad toml", "workers = \n", nil, nil, "failed to read config"},
+		{"bad env value", "", map[string]string{"GIFTS_WORKERS": "many"}, nil, "GIFTS_WORKERS"},
+		{"bad flag value", "", nil, []string{"-update-interval", "soon"}, "update-interval"},
+		{"zero workers", "", nil, []string{"-workers", "0"}, "scraper.workers"},
+		{"zero threshold", "[updater]\nthreshold = 0\n", nil, nil, "updater.threshold"},
+		{"negative threshold", "", nil, []string{"-update-threshold", "-1"}, "updater.threshold"},
+		{"unknown backend", "", map[string]string{"GIFTS_STORAGE": "csv"}, nil, "storage.backend"},
+		{"unknown progress format", "", nil, []string{"-progress", "xml"}, "progress.format"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			for k, v := range c.env {
+				t.Setenv(k, v)
+			}
+			args := c.args
+			if c.file != "" {
+				args = append([]string{"-config", writeConfig(t, c.file)}, args...)
+			}
+			_, _, err := Load(args)
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Fatalf("Load = %v, want an error containing %q", err, c.want)
+			}
+		})
+	}
+
+	// A missing default file is fine, a missing named one is not.
+	if _, _, err := Load([]string{"-config", filepath.Join(t.TempDir(), "missing.toml")}); err == nil {
+		t.Fatal("a missing -config file was accepted")
+	}
+}
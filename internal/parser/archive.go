@@ -0,0 +1,116 @@
+package parser
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"tg-gifts-parser/internal/storage"
+
+	"golang.org/x/net/html"
+)
+
+// Archive keeps the raw HTML of fetched pages as <Dir>/<slug>/<number>.html.gz.
+// The gzip header records when the page was fetched.
+type Archive struct {
+	Dir string
+}
+
+func (a *Archive) path(slug string, number int) string {
+	return filepath.Join(a.Dir, slug, strconv.Itoa(number)+".html.gz")
+}
+
+func (a *Archive) Store(slug string, number int, body []byte, fetchedAt time.Time) error {
+	path := a.path(slug, number)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	return storage.WriteFileAtomic(path, func(w io.Writer) error {
+		zw := gzip.NewWriter(w)
+		zw.Name = PageKey(slug, number) + ".html"
+		zw.ModTime = fetchedAt
+		if _, err := zw.Write(body); err != nil {
+			return err
+		}
+		return zw.Close()
+	})
+}
+
+// Load returns the archived page and the time it was fetched.
+func (a *Archive) Load(slug string, number int) ([]byte, time.Time, error) {
+	f, err := os.Open(a.path(slug, number))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("%s: %w", a.path(slug, number), err)
+	}
+	defer zr.Close()
+
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("%s: %w", a.path(slug, number), err)
+	}
+	return body, zr.ModTime, nil
+}
+
+// Numbers lists the archived numbers of slug in ascending order.
+func (a *Archive) Numbers(slug string) ([]int, error) {
+	entries, err := os.ReadDir(filepath.Join(a.Dir, slug))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var numbers []int
+	for _, e := range entries {
+		n, err := strconv.Atoi(strings.TrimSuffix(e.Name(), ".html.gz"))
+		if err != nil || e.IsDir() {
+			continue
+		}
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	return numbers, nil
+}
+
+// Parse runs an archived page through the same checks as a live fetch.
+func (a *Archive) Parse(slug string, number int) (*html.Node, time.Time, error) {
+	body, fetchedAt, err := a.Load(slug, number)
+	if os.IsNotExist(err) {
+		return nil, time.Time{}, &FetchError{Kind: ErrNotFound, URL: a.path(slug, number)}
+	}
+	if err != nil {
+		return nil, time.Time{}, &FetchError{Kind: ErrTransport, URL: a.path(slug, number), Err: err}
+	}
+
+	doc, err := parsePage(bytes.NewReader(body), a.path(slug, number))
+	return doc, fetchedAt, err
+}
+
+// ArchiveSource serves pages from an Archive without touching the network.
+type ArchiveSource struct {
+	Archive *Archive
+}
+
+func (s ArchiveSource) FetchPage(ctx context.Context, slug string, number int) (*html.Node, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	doc, _, err := s.Archive.Parse(slug, number)
+	return doc, err
+}
@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"fmt"
+	"time"
+
+	"tg-gifts-parser/internal/progress"
+)
+
+const (
+	CheckpointEvery    = 500
+	CheckpointInterval = 2 * time.Minute
+)
+
+// Checkpointer decides when a long scrape should flush what it has so far.
+type Checkpointer struct {
+	every    int
+	interval time.Duration
+	pending  int
+	last     time.Time
+}
+
+func NewCheckpointer(every int, interval time.Duration) *Checkpointer {
+	return &Checkpointer{every: every, interval: interval, last: time.Now()}
+}
+
+// Add counts n more writes since the last flush.
+func (c *Checkpointer) Add(n int) {
+	c.pending += n
+}
+
+// Due reports whether the writes counted so far should be flushed now.
+func (c *Checkpointer) Due() bool {
+	return c.pending >= c.every || (c.pending > 0 && time.Since(c.last) >= c.interval)
+}
+
+func (c *Checkpointer) Reset() {
+	c.pending = 0
+	c.last = time.Now()
+}
+
+// CheckpointWriter flushes the writes of one collection run every
+// CheckpointEvery rows or CheckpointInterval, whichever comes first, so an
+// interrupted run keeps most of what it fetched.
+type CheckpointWriter struct {
+	checkpoint *Checkpointer
+	flush      func() error
+	report     progress.Reporter
+}
+
+// NewCheckpointWriter checkpoints with flush, usually the store's Flush,
+// and reports failed checkpoints through report.
+func NewCheckpointWriter(flush func() error, report progress.Reporter) *CheckpointWriter {
+	return &CheckpointWriter{checkpoint: NewCheckpointer(CheckpointEvery, CheckpointInterval), flush: flush, report: report}
+}
+
+// Wrote counts n more rows written and flushes if a checkpoint is due. A
+// failed checkpoint is reported and tried again on the next call.
+func (w *CheckpointWriter) Wrote(n int) {
+	w.checkpoint.Add(n)
+	if !w.checkpoint.Due() {
+		return
+	}
+	if err := w.flush(); err != nil {
+		w.report.Warn("checkpoint failed", err)
+		return
+	}
+	w.checkpoint.Reset()
+}
+
+// Close flushes whatever the run has left.
+func (w *CheckpointWriter) Close() error {
+	if err := w.flush(); err != nil {
+		return fmt.Errorf("write database: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"tg-gifts-parser/internal/storage"
+)
+
+var (
+	ErrNotFound      = errors.New("gift not found or burned")
+	ErrRateLimited   = errors.New("rate limited")
+	ErrTransport     = errors.New("transport error")
+	ErrLayoutChanged = errors.New("page layout changed")
+)
+
+type FetchError struct {
+	Kind       error
+	URL        string
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *FetchError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v: %v", e.URL, e.Kind, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.URL, e.Kind)
+}
+
+func (e *FetchError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+type RetryPolicy struct {
+	Attempts int
+	Delay    time.Duration
+}
+
+var RetryPolicies = map[error]RetryPolicy{
+	ErrNotFound:      {Attempts: 1},
+	ErrRateLimited:   {Attempts: 6, Delay: 5 * time.Second},
+	ErrTransport:     {Attempts: 3, Delay: 2 * time.Second},
+	ErrLayoutChanged: {Attempts: 2, Delay: 2 * time.Second},
+}
+
+func ErrorKind(err error) error {
+	for _, kind := range []error{ErrNotFound, ErrRateLimited, ErrLayoutChanged, ErrTransport} {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+	return ErrTransport
+}
+
+func StatusOf(err error) string {
+	if err == nil {
+		return storage.StatusOK
+	}
+	switch ErrorKind(err) {
+	case ErrNotFound:
+		return storage.StatusNotFound
+	case ErrRateLimited:
+		return storage.StatusRateLimited
+	case ErrLayoutChanged:
+		return storage.StatusLayoutChanged
+	default:
+		return storage.StatusTransport
+	}
+}
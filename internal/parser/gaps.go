@@ -0,0 +1,41 @@
+package parser
+
+type GapReport struct {
+	Missing    []int
+	Duplicates []int
+	// Contiguous is the highest n such that every number in 1..n is present.
+	Contiguous int
+}
+
+func FindGaps(numbers []int32, upTo int) GapReport {
+	seen := make(map[int]int, len(numbers))
+	for _, n := range numbers {
+		seen[int(n)]++
+	}
+
+	var report GapReport
+	contiguous := true
+	for n := 1; n <= upTo; n++ {
+		switch count := seen[n]; {
+		case count == 0:
+			report.Missing = append(report.Missing, n)
+			contiguous = false
+		case count > 1:
+			report.Duplicates = append(report.Duplicates, n)
+		}
+		if contiguous {
+			report.Contiguous = n
+		}
+	}
+	return report
+}
+
+func MaxNumber(numbers []int32) int {
+	highest := 0
+	for _, n := range numbers {
+		if int(n) > highest {
+			highest = int(n)
+		}
+	}
+	return highest
+}
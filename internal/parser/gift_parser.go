@@ -1,36 +1,166 @@
 package parser
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
-	"time"
+
+	"tg-gifts-parser/internal/progress"
 
 	"github.com/antchfx/htmlquery"
 	"golang.org/x/net/html"
 )
 
-func FetchHTML(url string, attempts int, delay time.Duration) (*html.Node, error) {
-	var err error
-	for i := 0; i < attempts; i++ {
-		resp, err := http.Get(url)
-		if err == nil {
-			defer resp.Body.Close()
-			doc, parseErr := htmlquery.Parse(resp.Body)
-			if parseErr == nil {
-				return doc, nil
+// fetchHTML fetches and parses rawURL, retrying per RetryPolicies. With a
+// proxy pool every attempt goes through the next healthy proxy, each with its
+// own rate limit. keep, when set, receives the body of every page the server
+// returned.
+func fetchHTML(ctx context.Context, client *http.Client, proxies *ProxyPool, rawURL string, keep func(body []byte)) (*html.Node, error) {
+	host := hostOf(rawURL)
+
+	attempts := make(map[error]int)
+	for {
+		attemptClient := client
+		limiter := limiterFor(host)
+		var px *Proxy
+		if proxies != nil {
+			var err error
+			if px, err = proxies.Pick(ctx); err != nil {
+				return nil, err
 			}
-			err = fmt.Errorf("failed to parse HTML: %w", parseErr)
+			attemptClient = px.client
+			limiter = limiterFor(host + " via " + px.Name())
+		}
+
+		if err := limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+
+		doc, err := fetchOnce(ctx, attemptClient, rawURL, keep)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		limiter.Observe(err != nil && !errors.Is(err, ErrNotFound))
+		if px != nil {
+			proxies.Report(px, err)
+		}
+		if err == nil {
+			return doc, nil
+		}
+
+		kind := ErrorKind(err)
+		attempts[kind]++
+		policy := RetryPolicies[kind]
+		if attempts[kind] >= policy.Attempts {
+			return nil, err
+		}
+
+		progress.Emit(progress.Event{Kind: progress.FetchRetry, URL: rawURL, Attempt: attempts[kind], Total: policy.Attempts, Error: err.Error()})
+
+		var fetchErr *FetchError
+		if errors.As(err, &fetchErr) && fetchErr.RetryAfter > 0 {
+			limiter.Pause(fetchErr.RetryAfter)
+		} else if kind == ErrRateLimited {
+			limiter.Pause(backoff(policy.Delay, attempts[kind]-1))
+		} else if err := sleepContext(ctx, backoff(policy.Delay, attempts[kind]-1)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// UserAgent is sent with every page request when set; otherwise Go's default
+// is used.
+var UserAgent string
+
+func fetchOnce(ctx context.Context, client *http.Client, rawURL string, keep func(body []byte)) (*html.Node, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, &FetchError{Kind: ErrTransport, URL: rawURL, Err: err}
+	}
+	if UserAgent != "" {
+		req.Header.Set("User-Agent", UserAgent)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, &FetchError{Kind: ErrTransport, URL: rawURL, Err: err}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return nil, &FetchError{
+			Kind:       ErrRateLimited,
+			URL:        rawURL,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, &FetchError{Kind: ErrNotFound, URL: rawURL}
+	case resp.StatusCode >= 500:
+		return nil, &FetchError{
+			Kind:       ErrTransport,
+			URL:        rawURL,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+			Err:        fmt.Errorf("unexpected status %s", resp.Status),
 		}
-		fmt.Printf("Fetch failed for %s (attempt %d/%d): %v\n", url, i+1, attempts, err)
-		time.Sleep(delay)
+	case resp.StatusCode != http.StatusOK:
+		return nil, &FetchError{Kind: ErrTransport, URL: rawURL, Err: fmt.Errorf("unexpected status %s", resp.Status)}
+	}
+
+	if keep == nil {
+		return parsePage(resp.Body, rawURL)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &FetchError{Kind: ErrTransport, URL: rawURL, Err: err}
 	}
-	return nil, err
+	keep(body)
+	return parsePage(bytes.NewReader(body), rawURL)
+}
+
+func parsePage(r io.Reader, location string) (*html.Node, error) {
+	doc, err := htmlquery.Parse(r)
+	if err != nil {
+		return nil, &FetchError{Kind: ErrLayoutChanged, URL: location, Err: fmt.Errorf("failed to parse HTML: %w", err)}
+	}
+
+	if fieldCell(doc, "Model") != nil {
+		if err := ValidatePage(doc); err != nil {
+			return nil, &FetchError{Kind: ErrLayoutChanged, URL: location, Err: err}
+		}
+		return doc, nil
+	}
+	// t.me answers a number that does not exist (or was burned) with its
+	// generic contact page. Anything else without gift fields is markup we
+	// do not know, and storing it as not_found would hide it from repair.
+	if isContactPage(doc) {
+		return nil, &FetchError{Kind: ErrNotFound, URL: location}
+	}
+	return nil, &FetchError{Kind: ErrLayoutChanged, URL: location, Err: errors.New("gift fields missing")}
+}
+
+// isContactPage reports whether doc is the "Telegram: Contact @nft" page.
+func isContactPage(doc *html.Node) bool {
+	meta := htmlquery.FindOne(doc, `//meta[@property="og:title"]`)
+	return meta != nil && strings.HasPrefix(strings.TrimSpace(htmlquery.SelectAttr(meta, "content")), "Telegram: Contact @")
+}
+
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Host
 }
 
 func ExtractGiftField(doc *html.Node, field string) string {
-	td := htmlquery.FindOne(doc, fmt.Sprintf(`//th[contains(normalize-space(.), "%s")]/following-sibling::td`, field))
+	td := fieldCell(doc, field)
 	if td == nil {
 		return "Unknown"
 	}
@@ -43,10 +173,23 @@ func ExtractGiftField(doc *html.Node, field string) string {
 	return text
 }
 
+var titleNumberPattern = regexp.MustCompile(`\s*#[\d\s]+$`)
+
+// ExtractGiftTitle returns the collection name from the page title, e.g.
+// "Plush Pepe" for "Plush Pepe #1", or "" when the page has no title.
+func ExtractGiftTitle(doc *html.Node) string {
+	meta := htmlquery.FindOne(doc, `//meta[@property="og:title"]`)
+	if meta == nil {
+		return ""
+	}
+	title := strings.TrimSpace(htmlquery.SelectAttr(meta, "content"))
+	return strings.TrimSpace(titleNumberPattern.ReplaceAllString(title, ""))
+}
+
 func ParseGiftInfo(doc *html.Node) map[string]string {
 	info := make(map[string]string)
 
-	if ownerTd := htmlquery.FindOne(doc, `//th[contains(normalize-space(.), "Owner")]/following-sibling::td`); ownerTd != nil {
+	if ownerTd := fieldCell(doc, "Owner"); ownerTd != nil {
 		var name, href string
 		if a := htmlquery.FindOne(ownerTd, `a`); a != nil {
 			href = strings.TrimSpace(htmlquery.SelectAttr(a, "href"))
@@ -65,8 +208,13 @@ func ParseGiftInfo(doc *html.Node) map[string]string {
 		if href != "" {
 			info["Owner"] += fmt.Sprintf(" (%s)", href)
 		}
+		info["OwnerName"] = strings.TrimSpace(name)
+		info["OwnerUsername"] = OwnerUsername(href)
+		info["OwnerHidden"] = strconv.FormatBool(href == "")
 	} else {
 		info["Owner"] = "Unknown"
+		info["OwnerName"] = "Unknown"
+		info["OwnerHidden"] = "false"
 	}
 
 	for _, field := range []string{"Model", "Backdrop", "Symbol", "Quantity"} {
@@ -76,8 +224,41 @@ func ParseGiftInfo(doc *html.Node) map[string]string {
 	return info
 }
 
+func OwnerUsername(href string) string {
+	for _, prefix := range []string{"https://t.me/", "http://t.me/", "tg://resolve?domain="} {
+		if strings.HasPrefix(href, prefix) {
+			return strings.TrimPrefix(href, prefix)
+		}
+	}
+	return href
+}
+
 func CleanQuantity(q string) int {
-	cleaned := strings.Split(q, `/`)
-	num, _ := strconv.Atoi(strings.ReplaceAll(strings.ReplaceAll(cleaned[0], "\u00A0", ""), " ", ""))
+	issued, _ := ParseQuantity(q)
+	return issued
+}
+
+// ParseQuantity reads "12 345/50 000 issued" as (12345, 50000). Total is zero
+// when the page only shows the issued count.
+func ParseQuantity(q string) (issued, total int) {
+	parts := strings.SplitN(q, `/`, 2)
+	issued = leadingNumber(parts[0])
+	if len(parts) == 2 {
+		total = leadingNumber(parts[1])
+	}
+	return issued, total
+}
+
+func leadingNumber(s string) int {
+	s = strings.TrimSpace(strings.ReplaceAll(s, "\u00A0", " "))
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		} else if r != ' ' && r != ',' {
+			break
+		}
+	}
+	num, _ := strconv.Atoi(b.String())
 	return num
 }
@@ -0,0 +1,114 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"tg-gifts-parser/internal/storage"
+
+	"github.com/antchfx/htmlquery"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files from the current parser output")
+
+// goldenDir holds saved gift pages, named like PageKey, next to the
+// <name>.golden.json files recording what every extraction path returns.
+const goldenDir = "testdata/pages"
+
+type goldenResult struct {
+	Status           string            `json:"status"`
+	Error            string            `json:"error,omitempty"`
+	Title            string            `json:"title"`
+	Info             map[string]string `json:"info"`
+	QuantityFallback string            `json:"quantity_fallback"`
+	Issued           int               `json:"issued"`
+	Total            int               `json:"total"`
+	Gift             storage.Gift      `json:"gift"`
+}
+
+func parseFixture(t *testing.T, name string) goldenResult {
+	t.Helper()
+	var result goldenResult
+
+	idx := strings.LastIndex(name, "-")
+	number, err := strconv.Atoi(name[idx+1:])
+	if idx < 0 || err != nil {
+		t.Fatalf("fixture %s is not named <slug>-<number>", name)
+	}
+	slug := name[:idx]
+
+	page := filepath.Join(goldenDir, name+".html")
+	f, err := os.Open(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	raw, err := htmlquery.Parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The raw extractors run even on rejected pages so a layout change
+	// shows up in their output too.
+	result.Title = ExtractGiftTitle(raw)
+	result.Info = ParseGiftInfo(raw)
+	result.QuantityFallback = ExtractQuantityFallback(raw)
+	result.Issued, result.Total = ParseQuantity(result.Info["Quantity"])
+
+	doc, fetchErr := DirSource{Dir: goldenDir}.FetchPage(context.Background(), slug, number)
+	result.Status = StatusOf(fetchErr)
+	if fetchErr != nil {
+		result.Error = strings.TrimPrefix(fetchErr.Error(), page+": ")
+	}
+	result.Gift = BuildGift(slug, number, doc, fetchErr)
+	result.Gift.FetchedAt = 0
+	return result
+}
+
+// TestGolden parses every saved page and compares the output with its golden
+// file. Run with -update after an intended parser change to rewrite them.
+func TestGolden(t *testing.T) {
+	pages, err := filepath.Glob(filepath.Join(goldenDir, "*.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) == 0 {
+		t.Fatalf("no fixtures in %s", goldenDir)
+	}
+
+	for _, page := range pages {
+		name := strings.TrimSuffix(filepath.Base(page), ".html")
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := json.NewEncoder(&buf)
+			enc.SetEscapeHTML(false)
+			enc.SetIndent("", "    ")
+			if err := enc.Encode(parseFixture(t, name)); err != nil {
+				t.Fatal(err)
+			}
+			got := buf.Bytes()
+
+			goldenPath := filepath.Join(goldenDir, name+".golden.json")
+			if *update {
+				if err := os.WriteFile(goldenPath, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("output differs from %s:\n%s", goldenPath, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"tg-gifts-parser/internal/progress"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	DefaultBaseURL = "https://t.me/nft"
+	// DefaultPageTimeout bounds one page request when NewHTTPSource is not
+	// given a client.
+	DefaultPageTimeout = 30 * time.Second
+)
+
+type PageSource interface {
+	FetchPage(ctx context.Context, slug string, number int) (*html.Node, error)
+}
+
+type HTTPSource struct {
+	Client  *http.Client
+	BaseURL string
+	// Archive, when set, keeps a copy of every page served with status 200.
+	Archive *Archive
+	// Proxies, when set, replaces Client with a rotating set of proxies.
+	Proxies *ProxyPool
+}
+
+func NewHTTPSource(client *http.Client, baseURL string) *HTTPSource {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultPageTimeout}
+	}
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &HTTPSource{
+		Client:  client,
+		BaseURL: strings.TrimRight(baseURL, "/"),
+	}
+}
+
+func (s *HTTPSource) PageURL(slug string, number int) string {
+	return fmt.Sprintf("%s/%s", s.BaseURL, PageKey(slug, number))
+}
+
+func (s *HTTPSource) FetchPage(ctx context.Context, slug string, number int) (*html.Node, error) {
+	if s.Archive == nil {
+		return fetchHTML(ctx, s.Client, s.Proxies, s.PageURL(slug, number), nil)
+	}
+	return fetchHTML(ctx, s.Client, s.Proxies, s.PageURL(slug, number), func(body []byte) {
+		if err := s.Archive.Store(slug, number, body, time.Now()); err != nil {
+			progress.Emit(progress.Event{Kind: progress.Warning, Gift: PageKey(slug, number), Slug: slug, Number: number, Message: "failed to archive page", Error: err.Error()})
+		}
+	})
+}
+
+// MemorySource serves pages from memory, keyed by PageKey.
+type MemorySource map[string]string
+
+func (s MemorySource) FetchPage(ctx context.Context, slug string, number int) (*html.Node, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	page, ok := s[PageKey(slug, number)]
+	if !ok {
+		return nil, &FetchError{Kind: ErrNotFound, URL: PageKey(slug, number)}
+	}
+	return parsePage(strings.NewReader(page), PageKey(slug, number))
+}
+
+// DirSource serves pages saved as <Dir>/<slug>-<number>.html.
+type DirSource struct {
+	Dir string
+}
+
+func (s DirSource) FetchPage(ctx context.Context, slug string, number int) (*html.Node, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(s.Dir, PageKey(slug, number)+".html")
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, &FetchError{Kind: ErrNotFound, URL: path}
+	}
+	if err != nil {
+		return nil, &FetchError{Kind: ErrTransport, URL: path, Err: err}
+	}
+	defer f.Close()
+
+	return parsePage(f, path)
+}
+
+var source PageSource = NewHTTPSource(nil, DefaultBaseURL)
+
+func SetPageSource(s PageSource) {
+	source = s
+}
+
+func FetchPage(ctx context.Context, slug string, number int) (*html.Node, error) {
+	return source.FetchPage(ctx, slug, number)
+}
+
+func PageKey(slug string, number int) string {
+	return fmt.Sprintf("%s-%d", slug, number)
+}
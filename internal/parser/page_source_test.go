@@ -0,0 +1,158 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"tg-gifts-parser/internal/progress"
+	"tg-gifts-parser/internal/storage"
+)
+
+const testGiftPage = `<html><head><meta property="og:title" content="Test Gift #%d"></head><body>
+<table class="tgme_gift_table"><tbody>
+<tr><th>Owner</th><td><a href="https://t.me/owner%d"><span>Owner %d</span></a></td></tr>
+<tr><th>Model</th><td>Model %d <mark>1%%</mark></td></tr>
+<tr><th>Backdrop</th><td>Black <mark>2%%</mark></td></tr>
+<tr><th>Symbol</th><td>Star <mark>0.5%%</mark></td></tr>
+<tr><th>Quantity</th><td>%d/10 issued</td></tr>
+</tbody></table></body></html>`
+
+// useTestSource points the package at src and a scratch database for the
+// length of the test.
+func useTestSource(t *testing.T, src PageSource) {
+	t.Helper()
+	dir := t.TempDir()
+	prevSource, prevDir, prevSupply := source, storage.Dir, SupplyPath
+	SetPageSource(src)
+	storage.Dir = filepath.Join(dir, "database")
+	SupplyPath = filepath.Join(dir, "supply.json")
+	progress.SetSink(progress.SinkFunc(func(progress.Event) {}))
+	t.Cleanup(func() {
+		SetPageSource(prevSource)
+		storage.Dir, SupplyPath = prevDir, prevSupply
+		progress.SetSink(progress.NewConsole(nil))
+	})
+}
+
+func TestHTTPSourceScrape(t *testing.T) {
+	const issued = 4
+	var mu sync.Mutex
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.URL.Path)
+		mu.Unlock()
+		n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/nft/TestGift-"))
+		if err != nil || n < 1 || n > issued || n == 3 {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, testGiftPage, n, n, n, n, issued)
+	}))
+	defer srv.Close()
+
+	src := NewHTTPSource(srv.Client(), srv.URL+"/nft/")
+	if src.Client.Timeout != 0 {
+		t.Fatalf("given client was replaced")
+	}
+	if NewHTTPSource(nil, "").Client.Timeout != DefaultPageTimeout {
+		t.Fatalf("default client has no timeout")
+	}
+	useTestSource(t, src)
+
+	stored, err := ParseGifts(context.Background(), []string{"Test Gift"})
+	if err != nil {
+		t.Fatalf("ParseGifts: %v", err)
+	}
+	if stored != issued {
+		t.Fatalf("stored %d rows, want %d (requests %v)", stored, issued, requests)
+	}
+
+	store, err := storage.Open(storage.Dir, "TestGift")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gifts, err := storage.ReadAll(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gifts) != issued {
+		t.Fatalf("read %d rows, want %d", len(gifts), issued)
+	}
+	for _, g := range gifts {
+		want := storage.StatusOK
+		if g.Number == 3 {
+			want = storage.StatusNotFound
+		}
+		if g.Status != want {
+			t.Errorf("#%d: status %q, want %q", g.Number, g.Status, want)
+		}
+		if want == storage.StatusOK && (g.Model != fmt.Sprintf("Model %d", g.Number) || g.OwnerUsername != fmt.Sprintf("owner%d", g.Number)) {
+			t.Errorf("#%d: parsed %+v", g.Number, g)
+		}
+	}
+
+	// A second run finds nothing missing and only asks for the supply page.
+	requests = nil
+	if stored, err := ParseGifts(context.Background(), []string{"Test Gift"}); err != nil || stored != 0 {
+		t.Fatalf("second run stored %d, %v", stored, err)
+	}
+	if len(requests) != 1 {
+		t.Fatalf("second run made requests %v", requests)
+	}
+}
+
+func TestMemorySourceScrape(t *testing.T) {
+	const issued = 3
+	pages := MemorySource{}
+	for _, n := range []int{1, 3} {
+		pages[PageKey("TestGift", n)] = fmt.Sprintf(testGiftPage, n, n, n, n, issued)
+	}
+	useTestSource(t, pages)
+
+	stored, err := ParseGifts(context.Background(), []string{"Test Gift"})
+	if err != nil || stored != issued {
+		t.Fatalf("ParseGifts stored %d, %v; want %d", stored, err, issued)
+	}
+	store, err := storage.Open(storage.Dir, "TestGift")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gifts, err := storage.ReadAll(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := map[int32]string{}
+	for _, g := range gifts {
+		statuses[g.Number] = g.Status
+	}
+	want := map[int32]string{1: storage.StatusOK, 2: storage.StatusNotFound, 3: storage.StatusOK}
+	for n, status := range want {
+		if statuses[n] != status {
+			t.Errorf("#%d: status %q, want %q", n, statuses[n], status)
+		}
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := pages.FetchPage(cancelled, "TestGift", 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("FetchPage after cancel gave %v", err)
+	}
+}
+
+func TestScrapeReportsCollectionErrors(t *testing.T) {
+	useTestSource(t, MemorySource{})
+
+	_, err := ParseGifts(context.Background(), []string{"Test Gift"})
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("a collection without a first page gave %v, want ErrNotFound", err)
+	}
+}
@@ -1,46 +1,37 @@
 package parser
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
-	"path/filepath"
-	"strconv"
 	"strings"
-	"sync"
 	"time"
 	"unicode"
 
+	"tg-gifts-parser/internal/progress"
+	"tg-gifts-parser/internal/storage"
+
 	"github.com/antchfx/htmlquery"
-	"github.com/xitongsys/parquet-go-source/local"
-	"github.com/xitongsys/parquet-go/reader"
-	"github.com/xitongsys/parquet-go/writer"
 	"golang.org/x/net/html"
 )
 
-const workerCount = 10
-
-type Gift struct {
-	ID       int32  `parquet:"name=id, type=INT32"`
-	Name     string `parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8"`
-	Model    string `parquet:"name=model, type=BYTE_ARRAY, convertedtype=UTF8"`
-	Backdrop string `parquet:"name=backdrop, type=BYTE_ARRAY, convertedtype=UTF8"`
-	Symbol   string `parquet:"name=symbol, type=BYTE_ARRAY, convertedtype=UTF8"`
-	Number   int32  `parquet:"name=number, type=INT32"`
-}
+// Workers is how many pages the scraper fetches at once.
+var Workers = 10
 
+// ExtractQuantityFallback finds the quantity on pages without a Quantity
+// table row, such as "Quantity: 12 345/50 000 issued" in free text, and
+// returns the text after the label for ParseQuantity, or "Unknown".
 func ExtractQuantityFallback(doc *html.Node) string {
-	text := htmlquery.InnerText(doc)
-	lines := strings.Split(text, "\n")
-	for _, line := range lines {
-		if strings.Contains(line, "Quantity") {
-			fields := strings.Fields(line)
-			for _, f := range fields {
-				fClean := strings.Trim(f, ":,() ")
-				if n, err := strconv.Atoi(fClean); err == nil && n > 0 {
-					return fClean
-				}
-			}
+	text := strings.ReplaceAll(htmlquery.InnerText(doc), "\u00A0", " ")
+	for _, line := range strings.Split(text, "\n") {
+		_, rest, ok := strings.Cut(line, "Quantity")
+		if !ok {
+			continue
+		}
+		rest = strings.TrimSpace(strings.TrimLeft(rest, ": \t"))
+		if issued, _ := ParseQuantity(rest); issued > 0 {
+			return rest
 		}
 	}
 	return "Unknown"
@@ -74,165 +65,68 @@ func LoadGiftsJSON(path string) ([]string, error) {
 	return keys, nil
 }
 
-func ensureParquetFile(path string) error {
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		fw, err := local.NewLocalFileWriter(path)
-		if err != nil {
-			return err
-		}
-		defer fw.Close()
-		pw, err := writer.NewParquetWriter(fw, new(Gift), 1)
-		if err != nil {
-			return err
-		}
-		if err := pw.WriteStop(); err != nil {
-			return err
-		}
-	}
-	return nil
+func BuildGift(key string, number int, doc *html.Node, fetchErr error) storage.Gift {
+	gift := storage.Gift{
+		ID:        int32(number),
+		Name:      key,
+		Number:    int32(number),
+		Status:    StatusOf(fetchErr),
+		FetchedAt: time.Now().Unix(),
+	}
+	if fetchErr != nil {
+		return gift
+	}
+
+	info := ParseGiftInfo(doc)
+	gift.Model, gift.ModelRarity = storage.SplitAttribute(info["Model"])
+	gift.Backdrop, gift.BackdropRarity = storage.SplitAttribute(info["Backdrop"])
+	gift.Symbol, gift.SymbolRarity = storage.SplitAttribute(info["Symbol"])
+	gift.OwnerName = info["OwnerName"]
+	gift.OwnerUsername = info["OwnerUsername"]
+	gift.OwnerHidden = info["OwnerHidden"] == "true"
+	return gift
 }
 
-func readAllGifts(path string) ([]Gift, error) {
-	fr, err := local.NewLocalFileReader(path)
-	if err != nil {
-		return nil, err
-	}
-	defer fr.Close()
-
-	pr, err := reader.NewParquetReader(fr, new(Gift), 1)
-	if err != nil {
-		return nil, err
-	}
-	defer pr.ReadStop()
-
-	num := int(pr.GetNumRows())
-	if num == 0 {
-		return []Gift{}, nil
-	}
-	gifts := make([]Gift, num)
-	if err := pr.Read(&gifts); err != nil {
-		return nil, err
-	}
-	return gifts, nil
+// ParseAndSaveGift fetches every number of the collection not yet stored and
+// reports how many rows it added. When ctx is cancelled it stops fetching,
+// writes what it has and returns an error wrapping ctx.Err().
+func ParseAndSaveGift(ctx context.Context, key string) (int, error) {
+	return scrapeCollections(ctx, []string{key})
 }
 
-func writeAllGifts(path string, gifts []Gift) error {
-	fw, err := local.NewLocalFileWriter(path)
+// ParseAllGifts scrapes every collection in gifts.json through one pool of
+// workers, so a large collection is spread over all of them instead of
+// holding up the run. Once ctx is cancelled no new collection starts;
+// running ones flush their partial results.
+func ParseAllGifts(ctx context.Context) (int, error) {
+	keys, err := LoadGiftsJSON(CatalogPath)
 	if err != nil {
-		return err
-	}
-	defer fw.Close()
-
-	pw, err := writer.NewParquetWriter(fw, new(Gift), 1)
-	if err != nil {
-		return err
-	}
-	for _, g := range gifts {
-		if err := pw.Write(g); err != nil {
-			return err
-		}
+		return 0, err
 	}
-	return pw.WriteStop()
+	return ParseGifts(ctx, keys)
 }
 
-func ParseAndSaveGift(key string, wg *sync.WaitGroup, sem chan struct{}) {
-	defer wg.Done()
-
-	keySlug := SanitizeKey(key)
-	filePath := filepath.Join("data/database", keySlug+".parquet")
-
-	fmt.Printf("Starting parsing gift %q, file: %s\n", key, filePath)
-
-	if err := ensureParquetFile(filePath); err != nil {
-		fmt.Printf("Failed to ensure parquet for %q: %v\n", key, err)
-		<-sem
-		return
-	}
-
-	url := fmt.Sprintf("https://t.me/nft/%s-1", keySlug)
-	doc, err := FetchHTML(url, 3, 2*time.Second)
-	if err != nil {
-		fmt.Printf("Failed to fetch first page for %q: %v\n", key, err)
-		<-sem
-		return
+// ParseGifts is ParseAllGifts for the given catalog keys only.
+func ParseGifts(ctx context.Context, keys []string) (int, error) {
+	if err := os.MkdirAll(storage.Dir, 0755); err != nil {
+		return 0, fmt.Errorf("failed to create database folder: %w", err)
 	}
 
-	quantityStr := ExtractGiftField(doc, "Quantity")
-	if quantityStr == "Unknown" {
-		quantityStr = ExtractQuantityFallback(doc)
-	}
-	quantity := CleanQuantity(quantityStr)
-	if quantity == 0 {
-		fmt.Printf("Warning: zero quantity for %q\n", key)
-		<-sem
-		return
-	}
-
-	fmt.Printf("Gift %q has quantity %d\n", key, quantity)
-
-	allGifts, err := readAllGifts(filePath)
-	if err != nil {
-		fmt.Printf("Error reading existing gifts for %q: %v\n", key, err)
-		<-sem
-		return
-	}
-	existingCount := len(allGifts)
-
-	for i := existingCount + 1; i <= quantity; i++ {
-		giftURL := fmt.Sprintf("https://t.me/nft/%s-%d", keySlug, i)
-		doc, err := FetchHTML(giftURL, 3, 2*time.Second)
-		if err != nil {
-			fmt.Printf("Warning: failed to fetch %s: %v\n", giftURL, err)
-			continue
-		}
-
-		info := ParseGiftInfo(doc)
-
-		newGift := Gift{
-			ID:       int32(i),
-			Name:     key,
-			Model:    info["Model"],
-			Backdrop: info["Backdrop"],
-			Symbol:   info["Symbol"],
-			Number:   int32(i),
-		}
-		allGifts = append(allGifts, newGift)
-
-		if i%1000 == 0 {
-			fmt.Printf("Parsed %q gift item #%d\n", key, i)
-		}
-	}
-
-	if err := writeAllGifts(filePath, allGifts); err != nil {
-		fmt.Printf("Error writing parquet for %q: %v\n", key, err)
-	}
-
-	fmt.Printf("Finished parsing gift %q\n", key)
-	<-sem
+	totalStored, err := scrapeCollections(ctx, keys)
+	progress.Emit(progress.Event{Kind: progress.Totals, Op: "scrape", Count: totalStored, Total: len(keys), Error: progress.ErrText(err)})
+	return totalStored, err
 }
 
-func ParseAllGifts() error {
-	keys, err := LoadGiftsJSON(filepath.Join("data", "gifts.json"))
-	if err != nil {
-		return err
-	}
-
-	if err := os.MkdirAll("data/database", 0755); err != nil {
-		return fmt.Errorf("failed to create database folder: %w", err)
-	}
-
-	var wg sync.WaitGroup
-	sem := make(chan struct{}, workerCount)
-
-	fmt.Printf("Starting to parse %d gifts concurrently with %d workers...\n", len(keys), workerCount)
-
-	for _, key := range keys {
-		wg.Add(1)
-		sem <- struct{}{}
-		go ParseAndSaveGift(key, &wg, sem)
+// Acquire takes a slot in sem, giving up once ctx is done.
+func Acquire(ctx context.Context, sem chan struct{}) bool {
+	select {
+	case sem <- struct{}{}:
+		if ctx.Err() != nil {
+			<-sem
+			return false
+		}
+		return true
+	case <-ctx.Done():
+		return false
 	}
-
-	wg.Wait()
-	fmt.Println("All gifts parsed and saved to separate .parquet files in the 'data/database/' folder")
-	return nil
 }
@@ -0,0 +1,178 @@
+package parser
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultRequestsPerSecond = 5.0
+	DefaultBurst             = 5
+
+	minRequestsPerSecond = 0.2
+	maxBackoff           = time.Minute
+	errorRateDecay       = 0.1
+	slowdownErrorRate    = 0.2
+)
+
+// hostLimiter is a token bucket that halves its rate while the recent error
+// rate is high and creeps back to the configured rate on success.
+type hostLimiter struct {
+	mu          sync.Mutex
+	rate        float64
+	maxRate     float64
+	burst       float64
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+	errorRate   float64
+}
+
+func newHostLimiter(perSecond float64, burst int) *hostLimiter {
+	return &hostLimiter{
+		rate:    perSecond,
+		maxRate: perSecond,
+		burst:   float64(burst),
+		tokens:  float64(burst),
+		last:    time.Now(),
+	}
+}
+
+func (l *hostLimiter) Wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		if now.Before(l.pausedUntil) {
+			d := l.pausedUntil.Sub(now)
+			l.mu.Unlock()
+			if err := sleepContext(ctx, d); err != nil {
+				return err
+			}
+			continue
+		}
+
+		l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		l.last = now
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+
+		d := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		l.mu.Unlock()
+		if err := sleepContext(ctx, d); err != nil {
+			return err
+		}
+	}
+}
+
+func (l *hostLimiter) Observe(failed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sample := 0.0
+	if failed {
+		sample = 1
+	}
+	l.errorRate = l.errorRate*(1-errorRateDecay) + sample*errorRateDecay
+
+	if failed && l.errorRate > slowdownErrorRate {
+		l.rate = math.Max(minRequestsPerSecond, l.rate/2)
+	} else if !failed {
+		l.rate = math.Min(l.maxRate, l.rate+l.maxRate*0.05)
+	}
+}
+
+func (l *hostLimiter) Pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until := time.Now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+	l.tokens = 0
+}
+
+var limiters = struct {
+	sync.Mutex
+	byHost    map[string]*hostLimiter
+	perSecond float64
+	burst     int
+}{
+	byHost:    make(map[string]*hostLimiter),
+	perSecond: DefaultRequestsPerSecond,
+	burst:     DefaultBurst,
+}
+
+func SetRateLimit(perSecond float64, burst int) {
+	limiters.Lock()
+	defer limiters.Unlock()
+
+	limiters.perSecond = perSecond
+	limiters.burst = burst
+	limiters.byHost = make(map[string]*hostLimiter)
+}
+
+func limiterFor(host string) *hostLimiter {
+	limiters.Lock()
+	defer limiters.Unlock()
+
+	l, ok := limiters.byHost[host]
+	if !ok {
+		l = newHostLimiter(limiters.perSecond, limiters.burst)
+		limiters.byHost[host] = l
+	}
+	return l
+}
+
+// sleepContext sleeps for d or until ctx is done, whichever comes first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// backoff doubles base per attempt, with jitter, up to maxBackoff. A zero
+// base means retry at once.
+func backoff(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	d := base << attempt
+	if d>>attempt != base || d > maxBackoff {
+		d = maxBackoff
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// parseRetryAfter reads a Retry-After header as seconds or an HTTP date,
+// capped at maxBackoff so one bad header cannot stall a host for hours.
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	var d time.Duration
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs > int(maxBackoff/time.Second) {
+			return maxBackoff
+		}
+		d = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(value); err == nil {
+		d = time.Until(t)
+	}
+	return max(0, min(d, maxBackoff))
+}
@@ -0,0 +1,42 @@
+package parser
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	if d := backoff(0, 3); d != 0 {
+		t.Errorf("zero base: got %s, want 0", d)
+	}
+	for attempt := range 4 {
+		d := backoff(time.Second, attempt)
+		if full := time.Second << attempt; d < full/2 || d > full {
+			t.Errorf("attempt %d: got %s, want %s..%s", attempt, d, full/2, full)
+		}
+	}
+	for _, attempt := range []int{10, 40, 70} {
+		if d := backoff(time.Second, attempt); d < maxBackoff/2 || d > maxBackoff {
+			t.Errorf("attempt %d: got %s, want at most %s", attempt, d, maxBackoff)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	cases := map[string]time.Duration{
+		"":                              0,
+		"soon":                          0,
+		"5":                             5 * time.Second,
+		"-5":                            0,
+		"86400":                         maxBackoff,
+		"99999999999999999999":          0,
+		"Mon, 02 Jan 2006 15:04:05 GMT": 0,
+		time.Now().Add(24 * time.Hour).UTC().Format(http.TimeFormat): maxBackoff,
+	}
+	for value, want := range cases {
+		if got := parseRetryAfter(value); got != want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"tg-gifts-parser/internal/progress"
+	"tg-gifts-parser/internal/storage"
+)
+
+// ChunkSize is how many numbers of a collection one worker fetches before
+// going back to the pool, so large collections spread over all workers.
+const ChunkSize = 500
+
+// A running chunk hands what it has fetched to its job every handoffEvery
+// pages or handoffInterval, whichever comes first, so rows reach the store
+// and checkpoints happen before the whole chunk is done.
+const (
+	handoffEvery    = 50
+	handoffInterval = 15 * time.Second
+)
+
+// collectionJob tracks one collection while its chunks are in the pool.
+// Chunks finish in any order but are written to the store in number order,
+// so a checkpoint never leaves a hole that resuming would skip over: rows of
+// the earliest unfinished chunk are stored as they arrive, later chunks wait
+// in parts until it is done.
+type collectionJob struct {
+	key    string
+	slug   string
+	report progress.Reporter
+	store  storage.GiftStore
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	mu     sync.Mutex
+	watch  *LayoutWatch
+	writer *CheckpointWriter
+	todo   int
+	stored int
+	next   int
+	left   int
+	parts  []chunkRows
+	err    error
+	onDone func(stored int, err error)
+}
+
+// chunkRows holds the rows a chunk has handed over that are not stored yet.
+type chunkRows struct {
+	rows []storage.Gift
+	done bool
+}
+
+type chunk struct {
+	job     *collectionJob
+	index   int
+	numbers []int
+}
+
+// CollectionPlan is what is left to fetch of one collection: every number
+// from Start, just past the contiguous run of stored rows, up to Quantity
+// that has no row yet.
+type CollectionPlan struct {
+	Store    storage.GiftStore
+	Quantity int
+	Start    int
+	Missing  []int
+}
+
+// PlanCollection opens the store of key, reads the issued count from the
+// collection's first page and lists the numbers still missing. A collection
+// that reports no issued items gets an empty plan.
+func PlanCollection(ctx context.Context, key string, report progress.Reporter) (CollectionPlan, error) {
+	var plan CollectionPlan
+	keySlug := SanitizeKey(key)
+	store, err := storage.Open(storage.Dir, keySlug)
+	if err != nil {
+		return plan, fmt.Errorf("open store for %q: %w", key, err)
+	}
+	plan.Store = store
+
+	supply, err := FetchSupply(ctx, key, report)
+	if err != nil {
+		return plan, err
+	}
+	plan.Quantity = supply.Issued
+	if plan.Quantity == 0 {
+		return plan, nil
+	}
+
+	existing, err := storage.ReadAll(store)
+	if err != nil {
+		return plan, fmt.Errorf("read gifts: %w", err)
+	}
+
+	numbers := storage.Numbers(existing)
+	present := make(map[int32]bool, len(numbers))
+	for _, n := range numbers {
+		present[n] = true
+	}
+	plan.Start = FindGaps(numbers, plan.Quantity).Contiguous + 1
+	for i := plan.Start; i <= plan.Quantity; i++ {
+		if !present[int32(i)] {
+			plan.Missing = append(plan.Missing, i)
+		}
+	}
+	return plan, nil
+}
+
+// planCollection plans key and splits what is missing into chunks. A
+// collection with nothing to do is finished on the spot.
+func planCollection(ctx context.Context, key string, onDone func(int, error)) ([]chunk, error) {
+	keySlug := SanitizeKey(key)
+	report := progress.Reporter{Op: "scrape", Gift: key, Slug: keySlug}
+	fail := func(err error) ([]chunk, error) {
+		report.Finished(0, 0, err)
+		onDone(0, err)
+		return nil, err
+	}
+
+	plan, err := PlanCollection(ctx, key, report)
+	if err != nil || plan.Quantity == 0 {
+		return fail(err)
+	}
+	missing := plan.Missing
+	report.Emit(progress.Event{Kind: progress.CollectionStarted, Quantity: plan.Quantity, Start: plan.Start, Total: len(missing)})
+	if len(missing) == 0 {
+		return fail(nil)
+	}
+
+	job := &collectionJob{
+		key:    key,
+		slug:   keySlug,
+		report: report,
+		store:  plan.Store,
+		watch:  NewLayoutWatch(LayoutWindow, LayoutMinSamples, LayoutMaxRate),
+		writer: NewCheckpointWriter(plan.Store.Flush, report),
+		todo:   len(missing),
+		onDone: onDone,
+	}
+	job.watch.Issued = plan.Quantity
+	job.ctx, job.cancel = context.WithCancelCause(ctx)
+
+	var chunks []chunk
+	for from := 0; from < len(missing); from += ChunkSize {
+		to := min(from+ChunkSize, len(missing))
+		chunks = append(chunks, chunk{job: job, index: len(chunks), numbers: missing[from:to]})
+	}
+	job.left = len(chunks)
+	job.parts = make([]chunkRows, len(chunks))
+	return chunks, nil
+}
+
+// run fetches the chunk's numbers until it is done or the job is cancelled,
+// handing them to the job as it goes.
+func (c chunk) run() {
+	job := c.job
+	var gifts []storage.Gift
+	last := time.Now()
+	for _, n := range c.numbers {
+		doc, err := FetchPage(job.ctx, job.slug, n)
+		if job.ctx.Err() != nil {
+			break
+		}
+		job.report.Item(n, err)
+		gift := BuildGift(job.key, n, doc, err)
+		gifts = append(gifts, gift)
+
+		job.mu.Lock()
+		aborted := job.watch.Observe(gift)
+		job.mu.Unlock()
+		if aborted != nil {
+			job.cancel(aborted)
+			break
+		}
+
+		if len(gifts) >= handoffEvery || time.Since(last) >= handoffInterval {
+			job.deliver(c.index, gifts, false)
+			gifts, last = nil, time.Now()
+		}
+	}
+	job.deliver(c.index, gifts, true)
+}
+
+// deliver takes rows of chunk index, with done set on its last call. It
+// stores whatever is next in line, checkpoints when due and wraps the job up
+// once its last chunk is done.
+func (job *collectionJob) deliver(index int, gifts []storage.Gift, done bool) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	job.parts[index].rows = append(job.parts[index].rows, gifts...)
+	job.parts[index].done = done
+	written := 0
+	for job.next < len(job.parts) {
+		part := &job.parts[job.next]
+		written += job.write(part.rows)
+		part.rows = nil
+		if !part.done {
+			break
+		}
+		job.next++
+	}
+	job.writer.Wrote(written)
+
+	if !done {
+		return
+	}
+	if job.left--; job.left > 0 {
+		return
+	}
+
+	err := job.err
+	if flushErr := job.writer.Close(); flushErr != nil && err == nil {
+		err = flushErr
+	}
+	if err == nil {
+		err = context.Cause(job.ctx)
+	}
+	job.cancel(nil)
+	job.report.Finished(job.stored, job.todo, err)
+	job.onDone(job.stored, err)
+}
+
+// write appends rows to the store and returns how many it stored; after a
+// failed write the job only drains.
+func (job *collectionJob) write(rows []storage.Gift) int {
+	if job.err != nil || len(rows) == 0 {
+		return 0
+	}
+	if err := job.store.Append(rows...); err != nil {
+		job.err = fmt.Errorf("store %s: %w", PageKey(job.slug, int(rows[0].Number)), err)
+		job.cancel(job.err)
+		return 0
+	}
+	job.stored += len(rows)
+	return len(rows)
+}
+
+// scrapeCollections plans up to Workers collections at a time and feeds
+// their chunks to a shared pool of Workers fetchers. Once ctx is
+// cancelled no new collection is planned, queued chunks drain without
+// fetching and every started collection flushes what it has. It returns the
+// rows stored and every collection error joined with ctx.Err().
+func scrapeCollections(ctx context.Context, keys []string) (int, error) {
+	work := make(chan chunk, Workers)
+	var workers sync.WaitGroup
+	for range Workers {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for c := range work {
+				c.run()
+			}
+		}()
+	}
+
+	var mu sync.Mutex
+	var jobs sync.WaitGroup
+	totalStored := 0
+	var errs []error
+	onDone := func(stored int, err error) {
+		mu.Lock()
+		totalStored += stored
+		// Cancellation is reported once, from ctx, below.
+		if err != nil && !errors.Is(err, context.Canceled) {
+			errs = append(errs, err)
+		}
+		mu.Unlock()
+		jobs.Done()
+	}
+
+	var planners sync.WaitGroup
+	sem := make(chan struct{}, Workers)
+	for _, key := range keys {
+		if !Acquire(ctx, sem) {
+			break
+		}
+		jobs.Add(1)
+		planners.Add(1)
+		go func(k string) {
+			defer planners.Done()
+			chunks, _ := planCollection(ctx, k, onDone)
+			<-sem
+			for _, c := range chunks {
+				work <- c
+			}
+		}(key)
+	}
+	planners.Wait()
+	close(work)
+	workers.Wait()
+	jobs.Wait()
+
+	return totalStored, errors.Join(append(errs, ctx.Err())...)
+}
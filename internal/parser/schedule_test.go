@@ -0,0 +1,72 @@
+package parser
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"tg-gifts-parser/internal/progress"
+	"tg-gifts-parser/internal/storage"
+)
+
+// recordingStore keeps appended rows in order and counts flushes.
+type recordingStore struct {
+	storage.GiftStore
+	numbers []int32
+	flushes int
+}
+
+func (s *recordingStore) Append(gifts ...storage.Gift) error {
+	for _, g := range gifts {
+		s.numbers = append(s.numbers, g.Number)
+	}
+	return nil
+}
+
+func (s *recordingStore) Flush() error {
+	s.flushes++
+	return nil
+}
+
+func TestDeliverStoresInOrderWhileChunksRun(t *testing.T) {
+	progress.SetSink(progress.SinkFunc(func(progress.Event) {}))
+	t.Cleanup(func() { progress.SetSink(progress.NewConsole(nil)) })
+
+	store := &recordingStore{}
+	var total int
+	job := &collectionJob{
+		slug:   "TestGift",
+		store:  store,
+		writer: &CheckpointWriter{checkpoint: NewCheckpointer(3, time.Hour), flush: store.Flush},
+		left:   2,
+		parts:  make([]chunkRows, 2),
+		onDone: func(stored int, err error) { total = stored },
+	}
+	job.ctx, job.cancel = context.WithCancelCause(context.Background())
+	rows := func(numbers ...int32) []storage.Gift {
+		var gifts []storage.Gift
+		for _, n := range numbers {
+			gifts = append(gifts, storage.Gift{Number: n, Status: storage.StatusOK})
+		}
+		return gifts
+	}
+	expect := func(step string, numbers []int32, flushes int) {
+		t.Helper()
+		if !slices.Equal(store.numbers, numbers) || store.flushes != flushes {
+			t.Fatalf("%s: stored %v with %d flushes, want %v with %d", step, store.numbers, store.flushes, numbers, flushes)
+		}
+	}
+
+	job.deliver(1, rows(4), false)
+	expect("later chunk first", nil, 0)
+	job.deliver(0, rows(1, 2), false)
+	expect("head chunk part", []int32{1, 2}, 0)
+	job.deliver(0, rows(3), true)
+	expect("head chunk done", []int32{1, 2, 3, 4}, 1)
+	job.deliver(1, rows(5), true)
+	expect("last chunk done", []int32{1, 2, 3, 4, 5}, 2)
+	if total != 5 {
+		t.Fatalf("job reported %d rows stored, want 5", total)
+	}
+}
@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"tg-gifts-parser/internal/progress"
+	"tg-gifts-parser/internal/storage"
+)
+
+var (
+	// CatalogPath is the gifts.json listing every collection and its models.
+	CatalogPath = "data/gifts.json"
+	// BasePath is base.json with the backdrop and symbol names.
+	BasePath   = "data/base.json"
+	SupplyPath = "data/supply.json"
+)
+
+type CollectionSupply struct {
+	Name       string    `json:"name"`
+	Slug       string    `json:"slug"`
+	Issued     int       `json:"issued"`
+	Total      int       `json:"total"`
+	ObservedAt time.Time `json:"observed_at"`
+}
+
+func (s CollectionSupply) SoldOut() bool {
+	return s.Total > 0 && s.Issued >= s.Total
+}
+
+func (s CollectionSupply) Progress() float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	return float64(s.Issued) / float64(s.Total)
+}
+
+func (s CollectionSupply) String() string {
+	if s.Total == 0 {
+		return fmt.Sprintf("%d issued", s.Issued)
+	}
+	if s.SoldOut() {
+		return fmt.Sprintf("%d/%d issued, sold out", s.Issued, s.Total)
+	}
+	return fmt.Sprintf("%d/%d issued (%.1f%%)", s.Issued, s.Total, s.Progress()*100)
+}
+
+var supplyMu sync.Mutex
+
+func LoadSupply(path string) (map[string]CollectionSupply, error) {
+	supply := make(map[string]CollectionSupply)
+
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return supply, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if err := json.Unmarshal(raw, &supply); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return supply, nil
+}
+
+func RecordSupply(path string, s CollectionSupply) error {
+	supplyMu.Lock()
+	defer supplyMu.Unlock()
+
+	supply, err := LoadSupply(path)
+	if err != nil {
+		return err
+	}
+	supply[s.Name] = s
+
+	raw, err := json.MarshalIndent(supply, "", "    ")
+	if err != nil {
+		return err
+	}
+	// supply.json is rewritten on every scrape; a torn write would read
+	// back as no supply at all.
+	return storage.WriteFileAtomic(path, func(w io.Writer) error {
+		_, err := w.Write(append(raw, '\n'))
+		return err
+	})
+}
+
+// FetchSupply reads the issued and total counts from the first page of a
+// collection and records them in SupplyPath.
+func FetchSupply(ctx context.Context, key string, report progress.Reporter) (CollectionSupply, error) {
+	keySlug := SanitizeKey(key)
+	doc, err := FetchPage(ctx, keySlug, 1)
+	if err != nil {
+		return CollectionSupply{}, fmt.Errorf("failed to fetch first page for %q: %w", key, err)
+	}
+
+	quantityStr := ExtractGiftField(doc, "Quantity")
+	if quantityStr == "Unknown" {
+		quantityStr = ExtractQuantityFallback(doc)
+	}
+	issued, total := ParseQuantity(quantityStr)
+	supply := CollectionSupply{Name: key, Slug: keySlug, Issued: issued, Total: total, ObservedAt: time.Now()}
+	if err := RecordSupply(SupplyPath, supply); err != nil {
+		report.Warn("failed to record supply", err)
+	}
+	if issued == 0 {
+		report.Warn("zero quantity", nil)
+	}
+	return supply, nil
+}
@@ -0,0 +1,116 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"tg-gifts-parser/internal/storage"
+
+	"github.com/antchfx/htmlquery"
+	"golang.org/x/net/html"
+)
+
+// rarityFields are the rows every gift page shows with a rarity <mark>. A
+// page missing any of them would otherwise be stored with "Unknown" values.
+var rarityFields = []string{"Model", "Backdrop", "Symbol"}
+
+func fieldCell(doc *html.Node, field string) *html.Node {
+	return htmlquery.FindOne(doc, fmt.Sprintf(`//th[contains(normalize-space(.), "%s")]/following-sibling::td`, field))
+}
+
+// ValidatePage checks that doc has the structure ParseGiftInfo relies on.
+func ValidatePage(doc *html.Node) error {
+	var problems []string
+	for _, field := range rarityFields {
+		td := fieldCell(doc, field)
+		switch {
+		case td == nil:
+			problems = append(problems, field+" row missing")
+		case strings.TrimSpace(htmlquery.InnerText(td)) == "":
+			problems = append(problems, field+" is empty")
+		case htmlquery.FindOne(td, "mark") == nil:
+			problems = append(problems, field+" has no rarity")
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid gift page: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+const (
+	LayoutWindow     = 50
+	LayoutMinSamples = 10
+	LayoutMaxRate    = 0.5
+)
+
+// LayoutWatch tracks how many of the recent pages of a collection could not
+// be parsed or came back not found, so a markup change stops a scrape after a
+// handful of requests instead of filling the database with failed rows.
+type LayoutWatch struct {
+	// Issued, when set, is the collection's issued count. Numbers above it
+	// are expected to be missing and do not count; numbers up to it should
+	// exist, so a run of not_found there means the pages are misread.
+	// Left at zero every number is taken to be issued.
+	Issued int
+
+	recent     []bool
+	next       int
+	samples    int
+	bad        int
+	minSamples int
+	maxRate    float64
+}
+
+func NewLayoutWatch(window, minSamples int, maxRate float64) *LayoutWatch {
+	return &LayoutWatch{recent: make([]bool, window), minSamples: minSamples, maxRate: maxRate}
+}
+
+// isBad reports whether g counts against the layout: unparseable, missing
+// attributes, or not found although issued.
+func (w *LayoutWatch) isBad(g storage.Gift) bool {
+	switch g.Status {
+	case storage.StatusLayoutChanged:
+		return true
+	case storage.StatusNotFound:
+		return w.Issued == 0 || int(g.Number) <= w.Issued
+	}
+	if g.Status != storage.StatusOK {
+		return false
+	}
+	for _, v := range []string{g.Model, g.Backdrop, g.Symbol} {
+		if v == "" || v == "Unknown" {
+			return true
+		}
+	}
+	return false
+}
+
+// Observe records one stored row and returns an ErrLayoutChanged error once
+// the share of unparseable or missing pages in the window goes over the
+// limit. Rate limits and transport errors say nothing about the layout and
+// are skipped.
+func (w *LayoutWatch) Observe(g storage.Gift) error {
+	if g.Status != storage.StatusOK && g.Status != storage.StatusNotFound && g.Status != storage.StatusLayoutChanged {
+		return nil
+	}
+
+	unknown := w.isBad(g)
+	if w.samples == len(w.recent) {
+		if w.recent[w.next] {
+			w.bad--
+		}
+	} else {
+		w.samples++
+	}
+	w.recent[w.next] = unknown
+	if unknown {
+		w.bad++
+	}
+	w.next = (w.next + 1) % len(w.recent)
+
+	if w.samples >= w.minSamples && float64(w.bad) > w.maxRate*float64(w.samples) {
+		return fmt.Errorf("%w: %d of the last %d pages could not be parsed or were not found", ErrLayoutChanged, w.bad, w.samples)
+	}
+	return nil
+}
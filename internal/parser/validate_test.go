@@ -0,0 +1,28 @@
+package parser
+
+import (
+	"errors"
+	"testing"
+
+	"tg-gifts-parser/internal/storage"
+)
+
+func TestLayoutWatchNotFound(t *testing.T) {
+	watch := NewLayoutWatch(LayoutWindow, LayoutMinSamples, LayoutMaxRate)
+	watch.Issued = 100
+	for n := 101; n < 101+LayoutWindow; n++ {
+		if err := watch.Observe(storage.Gift{Number: int32(n), Status: storage.StatusNotFound}); err != nil {
+			t.Fatalf("not_found past the issued count tripped the watch at #%d: %v", n, err)
+		}
+	}
+
+	watch = NewLayoutWatch(LayoutWindow, LayoutMinSamples, LayoutMaxRate)
+	watch.Issued = 100
+	var err error
+	for n := 1; n <= LayoutMinSamples && err == nil; n++ {
+		err = watch.Observe(storage.Gift{Number: int32(n), Status: storage.StatusNotFound})
+	}
+	if !errors.Is(err, ErrLayoutChanged) {
+		t.Fatalf("a run of not_found within the issued count gave %v", err)
+	}
+}
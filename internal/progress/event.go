@@ -0,0 +1,130 @@
+package progress
+
+import (
+	"sync"
+	"time"
+)
+
+type Kind string
+
+const (
+	CollectionStarted Kind = "collection_started"
+	ItemFetched       Kind = "item_fetched"
+	ItemFailed        Kind = "item_failed"
+	FetchRetry        Kind = "fetch_retry"
+	Warning           Kind = "warning"
+	// Info carries a one-off status line in Message, for commands that have
+	// no per-item progress.
+	Info               Kind = "info"
+	SegmentMerged      Kind = "segment_merged"
+	CollectionFinished Kind = "collection_finished"
+	Totals             Kind = "totals"
+)
+
+// Event is one step of a scrape. Op names the run that produced it (scrape,
+// update, repair, refresh) so a single log can hold several runs.
+type Event struct {
+	Kind     Kind      `json:"kind"`
+	Op       string    `json:"op,omitempty"`
+	Time     time.Time `json:"time"`
+	Gift     string    `json:"gift,omitempty"`
+	Slug     string    `json:"slug,omitempty"`
+	Number   int       `json:"number,omitempty"`
+	URL      string    `json:"url,omitempty"`
+	Quantity int       `json:"quantity,omitempty"`
+	Start    int       `json:"start,omitempty"`
+	Count    int       `json:"count,omitempty"`
+	// Total is the number of items a collection run looked at, or the number
+	// of collections in a Totals event.
+	Total   int    `json:"total,omitempty"`
+	Attempt int    `json:"attempt,omitempty"`
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type Sink interface {
+	Emit(e Event)
+}
+
+// SinkFunc lets a plain callback act as a Sink.
+type SinkFunc func(e Event)
+
+func (f SinkFunc) Emit(e Event) {
+	f(e)
+}
+
+// Multi fans every event out to each of its sinks in order.
+type Multi []Sink
+
+func (m Multi) Emit(e Event) {
+	for _, s := range m {
+		s.Emit(e)
+	}
+}
+
+// Channel forwards events to a channel; the receiver must keep up or the
+// scraper blocks.
+type Channel chan<- Event
+
+func (c Channel) Emit(e Event) {
+	c <- e
+}
+
+var (
+	mu   sync.Mutex
+	sink Sink = NewConsole(nil)
+)
+
+func SetSink(s Sink) {
+	mu.Lock()
+	defer mu.Unlock()
+	sink = s
+}
+
+// Emit stamps e and hands it to the current sink. Calls are serialised, so
+// sinks never see two events at once.
+func Emit(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	sink.Emit(e)
+}
+
+func ErrText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// Reporter fills in the fields shared by every event of one collection run.
+type Reporter struct {
+	Op   string
+	Gift string
+	Slug string
+}
+
+func (r Reporter) Emit(e Event) {
+	e.Op, e.Gift, e.Slug = r.Op, r.Gift, r.Slug
+	Emit(e)
+}
+
+// Item reports the outcome of fetching one number.
+func (r Reporter) Item(number int, err error) {
+	if err != nil {
+		r.Emit(Event{Kind: ItemFailed, Number: number, Error: err.Error()})
+		return
+	}
+	r.Emit(Event{Kind: ItemFetched, Number: number})
+}
+
+func (r Reporter) Warn(message string, err error) {
+	r.Emit(Event{Kind: Warning, Message: message, Error: ErrText(err)})
+}
+
+func (r Reporter) Finished(count, total int, err error) {
+	r.Emit(Event{Kind: CollectionFinished, Count: count, Total: total, Error: ErrText(err)})
+}
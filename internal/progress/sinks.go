@@ -0,0 +1,90 @@
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ConsoleEvery is how often the console reports fetched items of one
+// collection.
+const ConsoleEvery = 1000
+
+// Console renders events as the human-readable lines the scrapers used to
+// print directly.
+type Console struct {
+	w io.Writer
+}
+
+func NewConsole(w io.Writer) *Console {
+	if w == nil {
+		w = os.Stdout
+	}
+	return &Console{w: w}
+}
+
+func (c *Console) Emit(e Event) {
+	switch e.Kind {
+	case CollectionStarted:
+		line := fmt.Sprintf("Starting %s of gift %q: %d items", e.Op, e.Gift, e.Total)
+		if e.Gift == "" {
+			line = fmt.Sprintf("Starting %s: %d ranges", e.Op, e.Total)
+		}
+		if e.Quantity > 0 {
+			line += fmt.Sprintf(" from #%d of %d", e.Start, e.Quantity)
+		}
+		if e.Message != "" {
+			line += fmt.Sprintf(" (%s)", e.Message)
+		}
+		fmt.Fprintln(c.w, line)
+	case ItemFetched:
+		if e.Number%ConsoleEvery == 0 {
+			fmt.Fprintf(c.w, "Parsed %q gift item #%d\n", e.Gift, e.Number)
+		}
+	case ItemFailed:
+		fmt.Fprintf(c.w, "Warning: failed to fetch %s-%d: %s\n", e.Slug, e.Number, e.Error)
+	case FetchRetry:
+		fmt.Fprintf(c.w, "Fetch failed for %s (attempt %d/%d): %s\n", e.URL, e.Attempt, e.Total, e.Error)
+	case Warning:
+		line := "Warning: " + e.Message
+		if e.Gift != "" {
+			line += fmt.Sprintf(" for %q", e.Gift)
+		}
+		if e.Error != "" {
+			line += ": " + e.Error
+		}
+		fmt.Fprintln(c.w, line)
+	case Info:
+		fmt.Fprintln(c.w, e.Message)
+	case SegmentMerged:
+		fmt.Fprintf(c.w, "Merged %d rows of gift %q up to #%d (%s)\n", e.Count, e.Gift, e.Number, e.Message)
+	case CollectionFinished:
+		if e.Error != "" {
+			fmt.Fprintf(c.w, "Finished %s of gift %q with error after %d of %d items: %s\n", e.Op, e.Gift, e.Count, e.Total, e.Error)
+		} else {
+			fmt.Fprintf(c.w, "Finished %s of gift %q: %d of %d items\n", e.Op, e.Gift, e.Count, e.Total)
+		}
+	case Totals:
+		if e.Error != "" {
+			fmt.Fprintf(c.w, "Total for %s run: %d items across %d gifts (stopped: %s)\n", e.Op, e.Count, e.Total, e.Error)
+		} else {
+			fmt.Fprintf(c.w, "Total for %s run: %d items across %d gifts\n", e.Op, e.Count, e.Total)
+		}
+	default:
+		fmt.Fprintf(c.w, "%s %s %s\n", e.Kind, e.Gift, e.Message)
+	}
+}
+
+// JSONLines writes one JSON object per event.
+type JSONLines struct {
+	enc *json.Encoder
+}
+
+func NewJSONLines(w io.Writer) *JSONLines {
+	return &JSONLines{enc: json.NewEncoder(w)}
+}
+
+func (j *JSONLines) Emit(e Event) {
+	_ = j.enc.Encode(e)
+}
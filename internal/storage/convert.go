@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func newStore(backend, path string) GiftStore {
+	if backend == BackendSQLite {
+		return NewSQLiteStore(path)
+	}
+	return NewParquetStore(path)
+}
+
+// ConvertFile copies every row of the collection file src into a new file
+// at dst in the backend format, streaming where the formats allow. dst is
+// only replaced once the copy is complete.
+func ConvertFile(src, dst, backend string) (int, error) {
+	tmp := dst + ".tmp"
+	os.Remove(tmp)
+	store := newStore(backend, tmp)
+
+	converted := 0
+	err := Scan(src, func(gifts []Gift) error {
+		if err := store.Append(gifts...); err != nil {
+			return err
+		}
+		converted += len(gifts)
+		// Parquet rewrites the whole file on Flush, so only the SQLite
+		// store commits as it goes.
+		if backend == BackendSQLite {
+			return store.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = store.Flush()
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, fmt.Errorf("convert %s: %w", src, err)
+	}
+	return converted, nil
+}
+
+// Conversion is one collection file ConvertDir handled. Skipped is set when
+// Dst already existed and nothing was copied.
+type Conversion struct {
+	Src, Dst string
+	Rows     int
+	Skipped  bool
+}
+
+// ConvertDir converts every collection in dir that is stored in the other
+// backend's format to backend, leaving the source files in place. Collections
+// that already have a file in the target format are skipped. done is called
+// once per file.
+func ConvertDir(dir, backend string, done func(Conversion)) (int, error) {
+	from := BackendParquet
+	if backend == BackendParquet {
+		from = BackendSQLite
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+Ext(from)))
+	if err != nil {
+		return 0, err
+	}
+
+	converted := 0
+	for _, path := range paths {
+		dst := strings.TrimSuffix(path, Ext(from)) + Ext(backend)
+		if _, err := os.Stat(dst); err == nil {
+			done(Conversion{Src: path, Dst: dst, Skipped: true})
+			continue
+		}
+		rows, err := ConvertFile(path, dst, backend)
+		if err != nil {
+			return converted, err
+		}
+		done(Conversion{Src: path, Dst: dst, Rows: rows})
+		converted++
+	}
+	return converted, nil
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type Gift struct {
+	ID             int32  `parquet:"name=id, type=INT32" json:"id"`
+	Name           string `parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8" json:"name"`
+	Number         int32  `parquet:"name=number, type=INT32" json:"number"`
+	Model          string `parquet:"name=model, type=BYTE_ARRAY, convertedtype=UTF8" json:"model"`
+	Backdrop       string `parquet:"name=backdrop, type=BYTE_ARRAY, convertedtype=UTF8" json:"backdrop"`
+	Symbol         string `parquet:"name=symbol, type=BYTE_ARRAY, convertedtype=UTF8" json:"symbol"`
+	Status         string `parquet:"name=status, type=BYTE_ARRAY, convertedtype=UTF8" json:"status"`
+	OwnerName      string `parquet:"name=owner_name, type=BYTE_ARRAY, convertedtype=UTF8" json:"owner_name"`
+	OwnerUsername  string `parquet:"name=owner_username, type=BYTE_ARRAY, convertedtype=UTF8" json:"owner_username"`
+	OwnerHidden    bool   `parquet:"name=owner_hidden, type=BOOLEAN" json:"owner_hidden"`
+	ModelRarity    int32  `parquet:"name=model_rarity, type=INT32" json:"model_rarity"`
+	BackdropRarity int32  `parquet:"name=backdrop_rarity, type=INT32" json:"backdrop_rarity"`
+	SymbolRarity   int32  `parquet:"name=symbol_rarity, type=INT32" json:"symbol_rarity"`
+	FetchedAt      int64  `parquet:"name=fetched_at, type=INT64" json:"fetched_at"`
+}
+
+const (
+	StatusOK            = "ok"
+	StatusNotFound      = "not_found"
+	StatusRateLimited   = "rate_limited"
+	StatusTransport     = "transport_error"
+	StatusLayoutChanged = "layout_changed"
+)
+
+// IsRetryableStatus reports whether a stored row is a failed fetch worth
+// trying again, as opposed to real data or a burned item.
+func IsRetryableStatus(status string) bool {
+	return status != StatusOK && status != StatusNotFound
+}
+
+var percentPattern = regexp.MustCompile(` ?\(?(\d+(?:\.\d+)?)%\)?`)
+
+// SplitAttribute turns "Hothead 3% (3%)" into ("Hothead", 30); rarity is in
+// permille so one decimal place of the percentage survives.
+func SplitAttribute(s string) (string, int32) {
+	matches := percentPattern.FindAllStringSubmatch(s, -1)
+	if len(matches) == 0 {
+		return strings.TrimSpace(s), 0
+	}
+	percent, _ := strconv.ParseFloat(matches[len(matches)-1][1], 64)
+	return strings.TrimSpace(percentPattern.ReplaceAllString(s, "")), int32(math.Round(percent * 10))
+}
+
+// JoinAttribute is the inverse of SplitAttribute, in the "Dark Soul (0.8%)"
+// form used by gifts.json.
+func JoinAttribute(name string, permille int32) string {
+	if permille == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s (%s%%)", name, strconv.FormatFloat(float64(permille)/10, 'f', -1, 64))
+}
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+func MigrateFile(path string) (bool, error) {
+	version, err := FileSchemaVersion(path)
+	if err != nil {
+		return false, err
+	}
+	if version >= SchemaVersion {
+		return false, nil
+	}
+
+	store := NewParquetStore(path)
+	if err := store.load(); err != nil {
+		return false, fmt.Errorf("read %s: %w", path, err)
+	}
+	store.dirty = true
+	if err := store.Flush(); err != nil {
+		return false, fmt.Errorf("write %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// MigrateDir migrates every parquet file in dir that is behind SchemaVersion,
+// calling migrated with the path of each one rewritten.
+func MigrateDir(dir string, migrated func(path string)) (int, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.parquet"))
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, path := range paths {
+		ok, err := MigrateFile(path)
+		if err != nil {
+			return count, err
+		}
+		if ok {
+			migrated(path)
+			count++
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,346 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// ParquetStore keeps one collection in a single parquet file. The file is
+// read on first use and rewritten in full on Flush.
+type ParquetStore struct {
+	mu   sync.Mutex
+	path string
+	rows []Gift
+	// index holds the positions in rows of each number. Replace builds it
+	// and Append keeps it current until the rows are reordered.
+	index  map[int32][]int
+	loaded bool
+	dirty  bool
+}
+
+func NewParquetStore(path string) *ParquetStore {
+	return &ParquetStore{path: path}
+}
+
+func (s *ParquetStore) Path() string {
+	return s.path
+}
+
+func (s *ParquetStore) load() error {
+	if s.loaded {
+		return nil
+	}
+
+	if _, err := os.Stat(s.path); os.IsNotExist(err) {
+		s.rows = []Gift{}
+		s.loaded = true
+		return nil
+	}
+
+	version, err := FileSchemaVersion(s.path)
+	if err != nil {
+		return err
+	}
+
+	var rows []Gift
+	if version < SchemaVersion {
+		rows, err = readLegacyGifts(s.path)
+	} else {
+		rows, err = readGifts(s.path)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.rows = rows
+	s.loaded = true
+	return nil
+}
+
+func (s *ParquetStore) Append(gifts ...Gift) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	if s.index != nil {
+		for i, g := range gifts {
+			s.index[g.Number] = append(s.index[g.Number], len(s.rows)+i)
+		}
+	}
+	s.rows = append(s.rows, gifts...)
+	s.dirty = true
+	return nil
+}
+
+func (s *ParquetStore) Replace(gifts ...Gift) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	if s.index == nil {
+		s.index = make(map[int32][]int, len(s.rows))
+		for i, g := range s.rows {
+			s.index[g.Number] = append(s.index[g.Number], i)
+		}
+	}
+
+	// Rows are overwritten in place, one stored row per new one, so
+	// replacing a single number does not touch the rest of the collection.
+	used := make(map[int32]int, len(gifts))
+	for _, g := range gifts {
+		at := s.index[g.Number]
+		if k := used[g.Number]; k < len(at) {
+			s.rows[at[k]] = g
+		} else {
+			s.index[g.Number] = append(at, len(s.rows))
+			s.rows = append(s.rows, g)
+		}
+		used[g.Number]++
+	}
+	s.dirty = true
+
+	// Stored duplicates beyond the new rows are dropped.
+	drop := make(map[int]bool)
+	for number, k := range used {
+		for _, i := range s.index[number][k:] {
+			drop[i] = true
+		}
+	}
+	if len(drop) > 0 {
+		kept := s.rows[:0]
+		for i, g := range s.rows {
+			if !drop[i] {
+				kept = append(kept, g)
+			}
+		}
+		s.rows = kept
+		s.index = nil
+	}
+	return nil
+}
+
+func (s *ParquetStore) ReadRange(from, to int) ([]Gift, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	var gifts []Gift
+	for _, g := range s.rows {
+		if int(g.Number) >= from && int(g.Number) <= to {
+			gifts = append(gifts, g)
+		}
+	}
+	sort.SliceStable(gifts, func(i, j int) bool { return gifts[i].Number < gifts[j].Number })
+	return gifts, nil
+}
+
+func (s *ParquetStore) Query(q Query) ([]Gift, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	matches := make([]Gift, 0)
+	for _, g := range s.rows {
+		if q.Matches(g) {
+			matches = append(matches, g)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Number < matches[j].Number })
+	return matches, nil
+}
+
+func (s *ParquetStore) Count() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return 0, err
+	}
+	return len(s.rows), nil
+}
+
+func (s *ParquetStore) SchemaVersion() (int, error) {
+	if _, err := os.Stat(s.path); os.IsNotExist(err) {
+		return SchemaVersion, nil
+	}
+	return FileSchemaVersion(s.path)
+}
+
+func (s *ParquetStore) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	if !s.dirty {
+		if _, err := os.Stat(s.path); err == nil {
+			return nil
+		}
+	}
+
+	sort.SliceStable(s.rows, func(i, j int) bool { return s.rows[i].Number < s.rows[j].Number })
+	s.index = nil
+	if err := writeGifts(s.path, s.rows); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+func readGifts(path string) ([]Gift, error) {
+	fr, err := local.NewLocalFileReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fr.Close()
+
+	pr, err := reader.NewParquetReader(fr, new(Gift), 1)
+	if err != nil {
+		return nil, err
+	}
+	defer pr.ReadStop()
+
+	num := int(pr.GetNumRows())
+	gifts := make([]Gift, num)
+	if num > 0 {
+		if err := pr.Read(&gifts); err != nil {
+			return nil, err
+		}
+	}
+	return gifts, nil
+}
+
+// ScanBatch is how many rows Scan decodes at a time.
+const ScanBatch = 10000
+
+// Scan hands the rows of a parquet or SQLite collection file to fn in
+// batches of at most ScanBatch, in file order, without loading the whole
+// file. Parquet files in an older schema are converted batch by batch.
+func Scan(path string, fn func(gifts []Gift) error) error {
+	if strings.HasSuffix(path, Ext(BackendSQLite)) {
+		return scanSQLite(path, fn)
+	}
+
+	version, err := FileSchemaVersion(path)
+	if err != nil {
+		return err
+	}
+	if version < SchemaVersion {
+		return scanLegacyGifts(path, ScanBatch, fn)
+	}
+
+	fr, err := local.NewLocalFileReader(path)
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	pr, err := reader.NewParquetReader(fr, new(Gift), 1)
+	if err != nil {
+		return err
+	}
+	defer pr.ReadStop()
+
+	for remaining := int(pr.GetNumRows()); remaining > 0; {
+		batch := make([]Gift, min(ScanBatch, remaining))
+		if err := pr.Read(&batch); err != nil {
+			return err
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+		remaining -= len(batch)
+	}
+	return nil
+}
+
+func writeGifts(path string, gifts []Gift) error {
+	return WriteFileAtomic(path, func(w io.Writer) error {
+		return WriteSegment(w, gifts)
+	})
+}
+
+// WriteSegment encodes gifts as a standalone parquet file in the current
+// schema, the format stores are written in and workers upload.
+func WriteSegment(w io.Writer, gifts []Gift) error {
+	pw, err := writer.NewParquetWriterFromWriter(w, new(Gift), 1)
+	if err != nil {
+		return err
+	}
+	setSchemaVersion(pw)
+	for _, g := range gifts {
+		if err := pw.Write(g); err != nil {
+			return err
+		}
+	}
+	return pw.WriteStop()
+}
+
+// ReadSegment decodes a parquet file produced by WriteSegment.
+func ReadSegment(data []byte) ([]Gift, error) {
+	pr, err := reader.NewParquetReader(buffer.NewBufferFileFromBytes(data), new(Gift), 1)
+	if err != nil {
+		return nil, err
+	}
+	defer pr.ReadStop()
+
+	if version := fileVersion(pr); version != SchemaVersion {
+		return nil, fmt.Errorf("segment has schema v%d, want v%d", version, SchemaVersion)
+	}
+
+	num := int(pr.GetNumRows())
+	gifts := make([]Gift, num)
+	if num > 0 {
+		if err := pr.Read(&gifts); err != nil {
+			return nil, err
+		}
+	}
+	return gifts, nil
+}
+
+// WriteFileAtomic writes through a temporary file in the same directory and
+// renames it over path, so readers never see a half-written file.
+func WriteFileAtomic(path string, write func(w io.Writer) error) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	if err := write(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
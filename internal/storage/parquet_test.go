@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func testGift(number int32, model string) Gift {
+	return Gift{ID: number, Name: "Test Gift", Number: number, Model: model, Status: StatusOK}
+}
+
+// models lists the model of every stored row in number order.
+func models(t *testing.T, store GiftStore) []string {
+	t.Helper()
+	gifts, err := ReadAll(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, g := range gifts {
+		got = append(got, fmt.Sprintf("%d:%s", g.Number, g.Model))
+	}
+	return got
+}
+
+func TestParquetStoreReplace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "TestGift.parquet")
+	store := NewParquetStore(path)
+	if err := store.Append(testGift(1, "a"), testGift(2, "b"), testGift(2, "b2"), testGift(3, "c")); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		replace []Gift
+		want    string
+	}{
+		{[]Gift{testGift(1, "A")}, "[1:A 2:b 2:b2 3:c]"},
+		{[]Gift{testGift(2, "B")}, "[1:A 2:B 3:c]"},
+		{[]Gift{testGift(4, "d"), testGift(3, "C")}, "[1:A 2:B 3:C 4:d]"},
+		{[]Gift{testGift(4, "D"), testGift(4, "D2")}, "[1:A 2:B 3:C 4:D 4:D2]"},
+	}
+	for i, step := range steps {
+		if err := store.Replace(step.replace...); err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(models(t, store)); got != step.want {
+			t.Fatalf("step %d: rows %s, want %s", i, got, step.want)
+		}
+	}
+
+	// Rows appended after an indexed Replace are found by the next one.
+	if err := store.Append(testGift(5, "e")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Replace(testGift(5, "E")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Replace(testGift(1, "A2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := "[1:A2 2:B 3:C 4:D 4:D2 5:E]"
+	if got := fmt.Sprint(models(t, NewParquetStore(path))); got != want {
+		t.Fatalf("reopened rows %s, want %s", got, want)
+	}
+}
+
+func BenchmarkParquetStoreReplace(b *testing.B) {
+	const rows = 250000
+	store := NewParquetStore(filepath.Join(b.TempDir(), "TestGift.parquet"))
+	store.loaded = true
+	for n := int32(1); n <= rows; n++ {
+		store.rows = append(store.rows, testGift(n, "m"))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := store.Replace(testGift(int32(i%rows)+1, "r")); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// SchemaVersion is stored in the footer of every parquet file we write.
+// Files without it (including the DuckDB exports) are version 1.
+const SchemaVersion = 5
+
+const schemaVersionKey = "tg_gifts_schema_version"
+
+func setSchemaVersion(pw *writer.ParquetWriter) {
+	version := strconv.Itoa(SchemaVersion)
+	pw.Footer.KeyValueMetadata = append(pw.Footer.KeyValueMetadata, &parquet.KeyValue{
+		Key:   schemaVersionKey,
+		Value: &version,
+	})
+}
+
+func FileSchemaVersion(path string) (int, error) {
+	fr, err := local.NewLocalFileReader(path)
+	if err != nil {
+		return 0, err
+	}
+	defer fr.Close()
+
+	pr, err := reader.NewParquetReader(fr, nil, 1)
+	if err != nil {
+		return 0, err
+	}
+	defer pr.ReadStop()
+
+	return fileVersion(pr), nil
+}
+
+func fileVersion(pr *reader.ParquetReader) int {
+	for _, kv := range pr.Footer.KeyValueMetadata {
+		if kv.Key == schemaVersionKey && kv.Value != nil {
+			if version, err := strconv.Atoi(*kv.Value); err == nil {
+				return version
+			}
+		}
+	}
+	return 1
+}
+
+// readLegacyGifts reads a whole parquet file of any older schema; see
+// scanLegacyGifts.
+func readLegacyGifts(path string) ([]Gift, error) {
+	gifts := []Gift{}
+	err := scanLegacyGifts(path, ScanBatch, func(batch []Gift) error {
+		gifts = append(gifts, batch...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return gifts, nil
+}
+
+// scanLegacyGifts hands the rows of a parquet file of any older schema to fn
+// in batches of at most batch rows. Columns are matched to Gift fields by
+// case-insensitive name, missing columns are left zero and the attribute
+// strings of pre-v4 files are split into name and rarity.
+func scanLegacyGifts(path string, batch int, fn func(gifts []Gift) error) error {
+	fr, err := local.NewLocalFileReader(path)
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	pr, err := reader.NewParquetReader(fr, nil, 1)
+	if err != nil {
+		return err
+	}
+	defer pr.ReadStop()
+
+	for remaining := int(pr.GetNumRows()); remaining > 0; {
+		rows, err := pr.ReadByNumber(min(batch, remaining))
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return fmt.Errorf("%s: %d rows short", path, remaining)
+		}
+		remaining -= len(rows)
+
+		raw, err := json.Marshal(rows)
+		if err != nil {
+			return err
+		}
+		var gifts []Gift
+		if err := json.Unmarshal(raw, &gifts); err != nil {
+			return err
+		}
+		for i := range gifts {
+			g := &gifts[i]
+			if g.Status == "" {
+				g.Status = StatusOK
+			}
+			if g.ModelRarity == 0 && g.BackdropRarity == 0 && g.SymbolRarity == 0 {
+				g.Model, g.ModelRarity = SplitAttribute(g.Model)
+				g.Backdrop, g.BackdropRarity = SplitAttribute(g.Backdrop)
+				g.Symbol, g.SymbolRarity = SplitAttribute(g.Symbol)
+			}
+		}
+		if err := fn(gifts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
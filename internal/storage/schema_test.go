@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// legacyGift is the row layout of the first databases: no status, owner or
+// rarity columns, rarities embedded in the attribute strings.
+type legacyGift struct {
+	ID       int32  `parquet:"name=id, type=INT32"`
+	Name     string `parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Number   int32  `parquet:"name=number, type=INT32"`
+	Model    string `parquet:"name=model, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Backdrop string `parquet:"name=backdrop, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Symbol   string `parquet:"name=symbol, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+func writeLegacyFile(t *testing.T, path string, rows int) {
+	t.Helper()
+	fw, err := local.NewLocalFileWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fw.Close()
+	pw, err := writer.NewParquetWriter(fw, new(legacyGift), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := int32(1); n <= int32(rows); n++ {
+		g := legacyGift{ID: n, Name: "Test Gift", Number: n, Model: fmt.Sprintf("Model %d (1.5%%)", n), Backdrop: "Black (2%)", Symbol: "Star"}
+		if err := pw.Write(g); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pw.WriteStop(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScanLegacyGifts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "TestGift.parquet")
+	writeLegacyFile(t, path, 25)
+
+	if v, err := FileSchemaVersion(path); err != nil || v != 1 {
+		t.Fatalf("FileSchemaVersion = %d, %v; want 1", v, err)
+	}
+
+	var batches []int
+	next := int32(1)
+	err := scanLegacyGifts(path, 10, func(gifts []Gift) error {
+		batches = append(batches, len(gifts))
+		for _, g := range gifts {
+			want := Gift{
+				ID: next, Name: "Test Gift", Number: next, Status: StatusOK,
+				Model: fmt.Sprintf("Model %d", next), ModelRarity: 15,
+				Backdrop: "Black", BackdropRarity: 20, Symbol: "Star",
+			}
+			if g != want {
+				t.Fatalf("row %d = %+v, want %+v", next, g, want)
+			}
+			next++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(batches) != "[10 10 5]" {
+		t.Fatalf("batches %v, want [10 10 5]", batches)
+	}
+
+	// Scan and the parquet store read legacy files the same way.
+	scanned := 0
+	if err := Scan(path, func(gifts []Gift) error {
+		scanned += len(gifts)
+		return nil
+	}); err != nil || scanned != 25 {
+		t.Fatalf("Scan saw %d rows, %v", scanned, err)
+	}
+	gifts, err := ReadAll(NewParquetStore(path))
+	if err != nil || len(gifts) != 25 || gifts[24].Model != "Model 25" {
+		t.Fatalf("ReadAll = %d rows, %v", len(gifts), err)
+	}
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// SearchWorkers is how many collections Search reads at once.
+var SearchWorkers = runtime.NumCPU()
+
+// CollectionMatches are the rows of one collection that matched a query.
+type CollectionMatches struct {
+	Slug  string
+	Gifts []Gift
+}
+
+// Search runs q against every collection in slugs, SearchWorkers at a time,
+// and returns the collections with matches in slugs order, each ordered by
+// number. Collections without a store in dir have no matches. When ctx is
+// cancelled the collections searched so far are returned with ctx.Err().
+func Search(ctx context.Context, dir string, slugs []string, q Query) ([]CollectionMatches, error) {
+	found := make([][]Gift, len(slugs))
+	errs := make([]error, len(slugs))
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(SearchWorkers, len(slugs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				store, err := Open(dir, slugs[i])
+				if err == nil {
+					found[i], err = store.Query(q)
+				}
+				if err != nil {
+					errs[i] = fmt.Errorf("query %s: %w", slugs[i], err)
+				}
+			}
+		}()
+	}
+
+	var err error
+feed:
+	for i := range slugs {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			err = ctx.Err()
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	var matches []CollectionMatches
+	for i, slug := range slugs {
+		if errs[i] != nil && err == nil {
+			err = errs[i]
+		}
+		if len(found[i]) > 0 {
+			matches = append(matches, CollectionMatches{Slug: slug, Gifts: found[i]})
+		}
+	}
+	return matches, err
+}
@@ -0,0 +1,343 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	_ "modernc.org/sqlite"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS gifts (
+	id INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	number INTEGER NOT NULL,
+	model TEXT NOT NULL,
+	backdrop TEXT NOT NULL,
+	symbol TEXT NOT NULL,
+	status TEXT NOT NULL,
+	owner_name TEXT NOT NULL,
+	owner_username TEXT NOT NULL,
+	owner_hidden INTEGER NOT NULL,
+	model_rarity INTEGER NOT NULL,
+	backdrop_rarity INTEGER NOT NULL,
+	symbol_rarity INTEGER NOT NULL,
+	fetched_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS gifts_number ON gifts (number);
+CREATE INDEX IF NOT EXISTS gifts_model ON gifts (model);
+CREATE INDEX IF NOT EXISTS gifts_backdrop ON gifts (backdrop);
+CREATE INDEX IF NOT EXISTS gifts_symbol ON gifts (symbol);
+CREATE INDEX IF NOT EXISTS gifts_owner_name ON gifts (owner_name);
+CREATE INDEX IF NOT EXISTS gifts_owner_username ON gifts (owner_username);
+`
+
+const sqliteColumns = "id, name, number, model, backdrop, symbol, status, owner_name, owner_username, " +
+	"owner_hidden, model_rarity, backdrop_rarity, symbol_rarity, fetched_at"
+
+// SQLiteStore keeps one collection in its own SQLite file, indexed on
+// number and every attribute Query filters on. Writes go into a transaction
+// that Flush commits, so readers in other processes see either the old or
+// the new rows and never a half-written batch.
+type SQLiteStore struct {
+	mu   sync.Mutex
+	path string
+	db   *sql.DB
+	tx   *sql.Tx
+}
+
+func NewSQLiteStore(path string) *SQLiteStore {
+	return &SQLiteStore{path: path}
+}
+
+func (s *SQLiteStore) Path() string {
+	return s.path
+}
+
+// querier is what reads need from either the database or the pending
+// transaction.
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// openSQLite opens the file at path, creating the table and indexes first
+// when create is set.
+func openSQLite(path string, create bool) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(10000)&_pragma=journal_mode(wal)")
+	if err != nil {
+		return nil, err
+	}
+	// One connection, so an open write transaction is also what reads see.
+	db.SetMaxOpenConns(1)
+	if !create {
+		return db, nil
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	if _, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", SchemaVersion)); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// begin starts the write transaction Flush will commit, if one is not open.
+func (s *SQLiteStore) begin() error {
+	if s.tx != nil {
+		return nil
+	}
+	if s.db == nil {
+		db, err := openSQLite(s.path, true)
+		if err != nil {
+			return err
+		}
+		s.db = db
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	s.tx = tx
+	return nil
+}
+
+// read runs fn against the pending transaction when there is one, and
+// otherwise against a connection opened just for it. A missing file reads as
+// an empty collection and is not created.
+func (s *SQLiteStore) read(fn func(q querier) error) error {
+	if s.tx != nil {
+		return fn(s.tx)
+	}
+	if _, err := os.Stat(s.path); os.IsNotExist(err) {
+		return fn(emptyQuerier{})
+	}
+	db, err := openSQLite(s.path, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return fn(db)
+}
+
+func (s *SQLiteStore) insert(gifts []Gift) error {
+	stmt, err := s.tx.Prepare("INSERT INTO gifts (" + sqliteColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, g := range gifts {
+		_, err := stmt.Exec(g.ID, g.Name, g.Number, g.Model, g.Backdrop, g.Symbol, g.Status,
+			g.OwnerName, g.OwnerUsername, g.OwnerHidden, g.ModelRarity, g.BackdropRarity, g.SymbolRarity, g.FetchedAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStore) Append(gifts ...Gift) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.begin(); err != nil {
+		return err
+	}
+	return s.insert(gifts)
+}
+
+func (s *SQLiteStore) Replace(gifts ...Gift) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.begin(); err != nil {
+		return err
+	}
+	stmt, err := s.tx.Prepare("DELETE FROM gifts WHERE number = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, g := range gifts {
+		if _, err := stmt.Exec(g.Number); err != nil {
+			return err
+		}
+	}
+	return s.insert(gifts)
+}
+
+func (s *SQLiteStore) queryGifts(query string, args ...any) ([]Gift, error) {
+	var gifts []Gift
+	err := s.read(func(q querier) error {
+		rows, err := q.Query(query, args...)
+		if err != nil {
+			return err
+		}
+		if rows == nil {
+			return nil
+		}
+		gifts, err = scanSQLiteRows(rows)
+		return err
+	})
+	return gifts, err
+}
+
+func (s *SQLiteStore) ReadRange(from, to int) ([]Gift, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.queryGifts("SELECT "+sqliteColumns+" FROM gifts WHERE number BETWEEN ? AND ? ORDER BY number, rowid", from, to)
+}
+
+func (s *SQLiteStore) Query(q Query) ([]Gift, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	where := []string{"status = ?"}
+	args := []any{StatusOK}
+	for _, f := range []struct{ column, value string }{
+		{"model", q.Model}, {"backdrop", q.Backdrop}, {"symbol", q.Symbol},
+	} {
+		if f.value != "" {
+			where = append(where, f.column+" = ?")
+			args = append(args, f.value)
+		}
+	}
+	if q.Owner != "" {
+		where = append(where, "(owner_name = ? OR owner_username = ?)")
+		args = append(args, q.Owner, q.Owner)
+	}
+	if q.Number != 0 {
+		where = append(where, "number = ?")
+		args = append(args, q.Number)
+	}
+
+	matches, err := s.queryGifts("SELECT "+sqliteColumns+" FROM gifts WHERE "+strings.Join(where, " AND ")+" ORDER BY number, rowid", args...)
+	if matches == nil && err == nil {
+		matches = make([]Gift, 0)
+	}
+	return matches, err
+}
+
+func (s *SQLiteStore) Count() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	err := s.read(func(q querier) error {
+		rows, err := q.Query("SELECT count(*) FROM gifts")
+		if err != nil || rows == nil {
+			return err
+		}
+		defer rows.Close()
+		if rows.Next() {
+			err = rows.Scan(&count)
+		}
+		return err
+	})
+	return count, err
+}
+
+func (s *SQLiteStore) SchemaVersion() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	version := SchemaVersion
+	err := s.read(func(q querier) error {
+		rows, err := q.Query("PRAGMA user_version")
+		if err != nil || rows == nil {
+			return err
+		}
+		defer rows.Close()
+		if rows.Next() {
+			err = rows.Scan(&version)
+		}
+		return err
+	})
+	return version, err
+}
+
+// Flush commits the pending writes and releases the file. Like the parquet
+// store it creates an empty collection when nothing has been written yet.
+func (s *SQLiteStore) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tx == nil {
+		if _, err := os.Stat(s.path); err == nil {
+			return nil
+		}
+		if err := s.begin(); err != nil {
+			return err
+		}
+	}
+	err := s.tx.Commit()
+	s.tx = nil
+	if closeErr := s.db.Close(); err == nil {
+		err = closeErr
+	}
+	s.db = nil
+	return err
+}
+
+func scanSQLite(path string, fn func(gifts []Gift) error) error {
+	db, err := openSQLite(path, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	for last := int64(0); ; {
+		rows, err := db.Query("SELECT rowid, "+sqliteColumns+" FROM gifts WHERE rowid > ? ORDER BY rowid LIMIT ?", last, ScanBatch)
+		if err != nil {
+			return err
+		}
+		batch := make([]Gift, 0, ScanBatch)
+		for rows.Next() {
+			var g Gift
+			err := rows.Scan(&last, &g.ID, &g.Name, &g.Number, &g.Model, &g.Backdrop, &g.Symbol, &g.Status,
+				&g.OwnerName, &g.OwnerUsername, &g.OwnerHidden, &g.ModelRarity, &g.BackdropRarity, &g.SymbolRarity, &g.FetchedAt)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			batch = append(batch, g)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+	}
+}
+
+// emptyQuerier stands in for a collection file that does not exist yet.
+type emptyQuerier struct{}
+
+func (emptyQuerier) Query(string, ...any) (*sql.Rows, error) {
+	return nil, nil
+}
+
+func scanSQLiteRows(rows *sql.Rows) ([]Gift, error) {
+	defer rows.Close()
+	var gifts []Gift
+	for rows.Next() {
+		var g Gift
+		err := rows.Scan(&g.ID, &g.Name, &g.Number, &g.Model, &g.Backdrop, &g.Symbol, &g.Status,
+			&g.OwnerName, &g.OwnerUsername, &g.OwnerHidden, &g.ModelRarity, &g.BackdropRarity, &g.SymbolRarity, &g.FetchedAt)
+		if err != nil {
+			return nil, err
+		}
+		gifts = append(gifts, g)
+	}
+	return gifts, rows.Err()
+}
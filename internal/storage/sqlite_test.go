@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLiteStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "TestGift.db")
+	store := NewSQLiteStore(path)
+
+	if n, err := store.Count(); err != nil || n != 0 {
+		t.Fatalf("Count of a missing file = %d, %v", n, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("reading created the file: %v", err)
+	}
+
+	owned := testGift(3, "c")
+	owned.OwnerName, owned.OwnerUsername = "Owner", "owner"
+	burned := testGift(4, "")
+	burned.Status = StatusNotFound
+	if err := store.Append(testGift(1, "a"), testGift(2, "b"), testGift(2, "b2"), owned, burned); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Replace(testGift(2, "B"), testGift(1, "A")); err != nil {
+		t.Fatal(err)
+	}
+	// Pending writes are visible before Flush.
+	if got := fmt.Sprint(models(t, store)); got != "[1:A 2:B 3:c 4:]" {
+		t.Fatalf("rows before flush %s", got)
+	}
+	if err := store.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := NewSQLiteStore(path)
+	if n, err := reopened.Count(); err != nil || n != 4 {
+		t.Fatalf("Count = %d, %v; want 4", n, err)
+	}
+	if v, err := reopened.SchemaVersion(); err != nil || v != SchemaVersion {
+		t.Fatalf("SchemaVersion = %d, %v", v, err)
+	}
+	if got := fmt.Sprint(models(t, reopened)); got != "[1:A 2:B 3:c 4:]" {
+		t.Fatalf("reopened rows %s", got)
+	}
+	if gifts, err := reopened.ReadRange(2, 3); err != nil || len(gifts) != 2 || gifts[0].Number != 2 {
+		t.Fatalf("ReadRange(2, 3) = %+v, %v", gifts, err)
+	}
+
+	queries := []struct {
+		q    Query
+		want int
+	}{
+		{Query{}, 3},
+		{Query{Model: "B"}, 1},
+		{Query{Model: "missing"}, 0},
+		{Query{Owner: "Owner"}, 1},
+		{Query{Owner: "owner"}, 1},
+		{Query{Number: 4}, 0},
+		{Query{Number: 1, Model: "A"}, 1},
+	}
+	for _, c := range queries {
+		matches, err := reopened.Query(c.q)
+		if err != nil || matches == nil || len(matches) != c.want {
+			t.Errorf("Query(%+v) = %d rows, %v; want %d", c.q, len(matches), err, c.want)
+		}
+		for _, g := range matches {
+			if !c.q.Matches(g) {
+				t.Errorf("Query(%+v) returned %+v", c.q, g)
+			}
+		}
+	}
+
+	var scanned int
+	if err := Scan(path, func(gifts []Gift) error {
+		scanned += len(gifts)
+		return nil
+	}); err != nil || scanned != 4 {
+		t.Fatalf("Scan saw %d rows, %v", scanned, err)
+	}
+}
+
+func TestSQLiteStoreFlushCreatesEmptyCollection(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "TestGift.db")
+	if err := NewSQLiteStore(path).Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := NewSQLiteStore(path).Count(); err != nil || n != 0 {
+		t.Fatalf("Count = %d, %v", n, err)
+	}
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+)
+
+const DefaultDir = "data/database"
+
+// Dir is where collection stores live; it starts at DefaultDir and is
+// replaced from the config at startup.
+var Dir = DefaultDir
+
+const (
+	BackendParquet = "parquet"
+	BackendSQLite  = "sqlite"
+)
+
+// Backends are the store formats Open can use.
+var Backends = []string{BackendParquet, BackendSQLite}
+
+// Backend picks the store format Open uses; it is replaced from the config
+// at startup.
+var Backend = BackendParquet
+
+// GiftStore holds the rows of one gift collection. Writes are buffered until
+// Flush, which replaces the stored collection atomically.
+type GiftStore interface {
+	Append(gifts ...Gift) error
+	// Replace overwrites every row that shares a number with one of gifts.
+	Replace(gifts ...Gift) error
+	// ReadRange returns the rows numbered from..to inclusive, ordered by number.
+	ReadRange(from, to int) ([]Gift, error)
+	Query(q Query) ([]Gift, error)
+	Count() (int, error)
+	SchemaVersion() (int, error)
+	Flush() error
+}
+
+type Query struct {
+	Model    string
+	Backdrop string
+	Symbol   string
+	// Owner matches either the display name or the username.
+	Owner string
+	// Number matches one gift number in every collection; 0 matches all.
+	Number int32
+}
+
+func (q Query) Matches(g Gift) bool {
+	return g.Status == StatusOK &&
+		(q.Model == "" || g.Model == q.Model) &&
+		(q.Backdrop == "" || g.Backdrop == q.Backdrop) &&
+		(q.Symbol == "" || g.Symbol == q.Symbol) &&
+		(q.Owner == "" || g.OwnerName == q.Owner || g.OwnerUsername == q.Owner) &&
+		(q.Number == 0 || g.Number == q.Number)
+}
+
+func Open(dir, slug string) (GiftStore, error) {
+	switch Backend {
+	case BackendParquet:
+		return NewParquetStore(Path(dir, slug)), nil
+	case BackendSQLite:
+		return NewSQLiteStore(Path(dir, slug)), nil
+	}
+	return nil, fmt.Errorf("unknown storage backend %q", Backend)
+}
+
+// Ext is the file extension of a collection stored with backend.
+func Ext(backend string) string {
+	if backend == BackendSQLite {
+		return ".db"
+	}
+	return ".parquet"
+}
+
+// Path is where Open keeps the collection slug.
+func Path(dir, slug string) string {
+	return filepath.Join(dir, slug+Ext(Backend))
+}
+
+// Slugs lists the collections stored in dir with the current backend.
+func Slugs(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+Ext(Backend)))
+	if err != nil {
+		return nil, err
+	}
+	slugs := make([]string, len(paths))
+	for i, path := range paths {
+		slugs[i] = strings.TrimSuffix(filepath.Base(path), Ext(Backend))
+	}
+	return slugs, nil
+}
+
+func ReadAll(s GiftStore) ([]Gift, error) {
+	return s.ReadRange(0, math.MaxInt32)
+}
+
+func Numbers(gifts []Gift) []int32 {
+	numbers := make([]int32, len(gifts))
+	for i, g := range gifts {
+		numbers[i] = g.Number
+	}
+	return numbers
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"tg-gifts-parser/internal/parser"
 	"tg-gifts-parser/internal/tui/utils"
 
 	"github.com/charmbracelet/bubbles/spinner"
@@ -15,6 +16,7 @@ type Model struct {
 	values    []string
 	backdrops []string
 	symbols   []string
+	supply    map[string]parser.CollectionSupply
 
 	cursor     int
 	viewOffset int
@@ -26,13 +28,21 @@ type Model struct {
 	SelectedValue    string
 	SelectedBackdrop string
 	SelectedSymbol   string
+	SelectedNumber   int
+
+	// crossSearch is set while the results come from every collection
+	// rather than the selected gift.
+	crossSearch bool
+	numberInput string
 
 	width  int
 	height int
 
 	spinner spinner.Model
-	results []int
-	error   error
+	results []utils.Entry
+	// groupSizes counts results per gift for the cross-gift headers.
+	groupSizes map[string]int
+	error      error
 
 	searchActive      bool
 	searchQuery       string
@@ -43,19 +53,25 @@ type Model struct {
 }
 
 func InitialModel() Model {
-	data, keys, err := utils.LoadData("data/gifts.json")
+	data, keys, err := utils.LoadData(parser.CatalogPath)
 	if err != nil {
 		fmt.Println("Error loading gifts.json:", err)
 		os.Exit(1)
 	}
 
-	backdrops, symbols := utils.LoadBaseData("data/base.json")
+	backdrops, symbols := utils.LoadBaseData(parser.BasePath)
+
+	supply, err := parser.LoadSupply(parser.SupplyPath)
+	if err != nil {
+		supply = map[string]parser.CollectionSupply{}
+	}
 
 	return Model{
 		data:              data,
 		keys:              keys,
 		backdrops:         backdrops,
 		symbols:           symbols,
+		supply:            supply,
 		state:             mainMenu,
 		filteredKeys:      keys,
 		filteredValues:    []string{},
@@ -2,6 +2,7 @@ package tui
 
 import (
 	"math"
+	"strconv"
 	"strings"
 	"time"
 
@@ -20,15 +21,26 @@ const (
 	selectingModel
 	selectingBackdrop
 	selectingSymbols
+	enteringNumber
 	loadingResults
 	viewingResults
 	viewSize = 10
 )
 
+// Main menu items, in mainMenuItems order.
+const (
+	menuGift = iota
+	menuBackdrop
+	menuSymbols
+	menuNumber
+	menuStart
+	menuSearchAll
+)
+
 type loadingMsg struct{}
 
 type resultsMsg struct {
-	entries []int
+	entries []utils.Entry
 	err     error
 }
 
@@ -42,6 +54,9 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.width, m.height = msg.Width, msg.Height
 
 	case tea.KeyMsg:
+		if m.state == enteringNumber {
+			return m.handleNumberKey(msg)
+		}
 		if m.searchActive && (m.state == selectingGift || m.state == selectingModel || m.state == selectingBackdrop || m.state == selectingSymbols) {
 			switch msg.String() {
 			case "ctrl+f":
@@ -104,6 +119,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				case 0:
 					m.state = mainMenu
 					m.cursor, m.viewOffset, m.page = 0, 0, 0
+					m.crossSearch = false
 					m.searchActive = false
 					m.searchQuery = ""
 					m.resetFilteredLists()
@@ -135,6 +151,10 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if m.state == loadingResults {
 			m.results = msg.entries
 			m.error = msg.err
+			m.groupSizes = make(map[string]int)
+			for _, e := range m.results {
+				m.groupSizes[e.Key]++
+			}
 			m.state = viewingResults
 			m.cursor = 0
 			m.viewOffset = 0
@@ -151,16 +171,10 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 func (m *Model) moveCursorUp() {
 	if m.state == mainMenu {
-		switch m.cursor {
-		case 1:
-			m.cursor = 0
-		case 2:
-			m.cursor = 1
-		case 3:
-			if m.SelectedKey != "" && m.SelectedValue != "" && (m.SelectedBackdrop != "" || m.SelectedSymbol != "") {
-				m.cursor = 2
-			} else {
-				m.cursor = 1
+		for i := m.cursor - 1; i >= 0; i-- {
+			if m.menuItemEnabled(i) {
+				m.cursor = i
+				break
 			}
 		}
 	} else if m.state == viewingResults {
@@ -193,14 +207,10 @@ func (m *Model) moveCursorDown() {
 	}
 
 	if m.state == mainMenu {
-		switch m.cursor {
-		case 0:
-			m.cursor = 1
-		case 1:
-			m.cursor = 2
-		case 2:
-			if m.SelectedKey != "" && m.SelectedValue != "" && (m.SelectedBackdrop != "" || m.SelectedSymbol != "") {
-				m.cursor = 3
+		for i := m.cursor + 1; i < length; i++ {
+			if m.menuItemEnabled(i) {
+				m.cursor = i
+				break
 			}
 		}
 	} else if m.cursor < length-1 {
@@ -215,34 +225,43 @@ func (m *Model) handleEnter() (tea.Model, tea.Cmd) {
 	switch m.state {
 	case mainMenu:
 		switch m.cursor {
-		case 0:
+		case menuGift:
 			m.state = selectingGift
 			m.filteredKeys = m.keys
-		case 1:
+		case menuBackdrop:
 			m.state = selectingBackdrop
 			m.filteredBackdrops = m.backdrops
-		case 2:
+		case menuSymbols:
 			m.state = selectingSymbols
 			m.filteredSymbols = m.symbols
-		case 3:
-			if m.SelectedKey != "" && m.SelectedValue != "" && (m.SelectedBackdrop != "" || m.SelectedSymbol != "") {
-				m.state = loadingResults
-				m.spinner = spinner.New()
-				m.spinner.Spinner = spinner.Dot
-				m.spinner.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
-
-				return m, tea.Batch(
-					m.spinner.Tick,
-					tea.Tick(time.Millisecond*100, func(t time.Time) tea.Msg {
-						giftDB := "data/database/" + utils.SanitizeGiftName(m.SelectedKey) + ".parquet"
-						modelName := utils.RemovePercent(m.SelectedValue)
-						backdropName := utils.RemovePercent(m.SelectedBackdrop)
-						symbolName := utils.RemovePercent(m.SelectedSymbol)
-
-						entries, err := utils.QueryEntriesParquet(giftDB, modelName, backdropName, symbolName)
-						return resultsMsg{entries, err}
-					}),
-				)
+		case menuNumber:
+			m.state = enteringNumber
+			m.numberInput = ""
+			if m.SelectedNumber != 0 {
+				m.numberInput = strconv.Itoa(m.SelectedNumber)
+			}
+		case menuStart:
+			if m.canStart() {
+				m.crossSearch = false
+				key := m.SelectedKey
+				modelName := utils.RemovePercent(m.SelectedValue)
+				backdropName := utils.RemovePercent(m.SelectedBackdrop)
+				symbolName := utils.RemovePercent(m.SelectedSymbol)
+				number := m.SelectedNumber
+				return m.startSearch(func() ([]utils.Entry, error) {
+					return utils.QueryEntries(key, modelName, backdropName, symbolName, number)
+				})
+			}
+		case menuSearchAll:
+			if m.canSearchAll() {
+				m.crossSearch = true
+				keys := m.keys
+				backdropName := utils.RemovePercent(m.SelectedBackdrop)
+				symbolName := utils.RemovePercent(m.SelectedSymbol)
+				number := m.SelectedNumber
+				return m.startSearch(func() ([]utils.Entry, error) {
+					return utils.SearchAll(keys, backdropName, symbolName, number)
+				})
 			}
 		}
 	case selectingGift:
@@ -281,6 +300,69 @@ func (m *Model) handleEnter() (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// startSearch shows the spinner while search runs.
+func (m *Model) startSearch(search func() ([]utils.Entry, error)) (tea.Model, tea.Cmd) {
+	m.state = loadingResults
+	m.spinner = spinner.New()
+	m.spinner.Spinner = spinner.Dot
+	m.spinner.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
+
+	return m, tea.Batch(
+		m.spinner.Tick,
+		tea.Tick(time.Millisecond*100, func(t time.Time) tea.Msg {
+			entries, err := search()
+			return resultsMsg{entries, err}
+		}),
+	)
+}
+
+// canStart reports whether the single-gift search has enough to go on.
+func (m Model) canStart() bool {
+	return m.SelectedKey != "" && m.SelectedValue != "" && (m.SelectedBackdrop != "" || m.SelectedSymbol != "")
+}
+
+// canSearchAll reports whether a search across every gift is narrow enough
+// to run: the model belongs to one gift, so it needs a backdrop, symbol or
+// number.
+func (m Model) canSearchAll() bool {
+	return m.SelectedBackdrop != "" || m.SelectedSymbol != "" || m.SelectedNumber != 0
+}
+
+func (m Model) menuItemEnabled(i int) bool {
+	switch i {
+	case menuStart:
+		return m.canStart()
+	case menuSearchAll:
+		return m.canSearchAll()
+	}
+	return true
+}
+
+// handleNumberKey edits the number being entered; an empty number clears
+// the filter.
+func (m Model) handleNumberKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch key := msg.String(); key {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "enter":
+		m.SelectedNumber, _ = strconv.Atoi(m.numberInput)
+		m.state = mainMenu
+		m.cursor, m.viewOffset = 0, 0
+	case "backspace":
+		if m.numberInput != "" {
+			m.numberInput = m.numberInput[:len(m.numberInput)-1]
+		} else {
+			m.state = mainMenu
+			m.cursor, m.viewOffset = 0, 0
+		}
+	default:
+		if len(key) == 1 && key[0] >= '0' && key[0] <= '9' && len(m.numberInput) < 9 {
+			m.numberInput = strings.TrimLeft(m.numberInput+key, "0")
+		}
+	}
+	return m, nil
+}
+
 func (m *Model) handleBackspace() {
 	switch m.state {
 	case selectingModel:
@@ -1,63 +1,65 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 
-	"github.com/xitongsys/parquet-go-source/local"
-	"github.com/xitongsys/parquet-go/reader"
+	"tg-gifts-parser/internal/storage"
 )
 
-type Row struct {
-	Number   int32  `parquet:"name=number, type=INT32"`
-	Model    string `parquet:"name=model, type=BYTE_ARRAY, convertedtype=UTF8"`
-	Backdrop string `parquet:"name=backdrop, type=BYTE_ARRAY, convertedtype=UTF8"`
-	Symbol   string `parquet:"name=symbol, type=BYTE_ARRAY, convertedtype=UTF8"`
+// Entry is one matching gift: its collection key and number.
+type Entry struct {
+	Key    string
+	Number int
 }
 
-func QueryEntriesParquet(parquetPath, model, backdrop, symbol string) ([]int, error) {
-	fr, err := local.NewLocalFileReader(parquetPath)
+// QueryEntries searches the collection key; number 0 matches any number.
+func QueryEntries(key, model, backdrop, symbol string, number int) ([]Entry, error) {
+	slug := SanitizeGiftName(key)
+	store, err := storage.Open(storage.Dir, slug)
 	if err != nil {
-		return nil, fmt.Errorf("open parquet: %w", err)
+		return nil, err
 	}
-	defer fr.Close()
-
-	pr, err := reader.NewParquetReader(fr, new(Row), 4)
+	gifts, err := store.Query(storage.Query{
+		Model:    model,
+		Backdrop: backdrop,
+		Symbol:   symbol,
+		Number:   int32(number),
+	})
 	if err != nil {
-		return nil, fmt.Errorf("new parquet reader: %w", err)
+		return nil, fmt.Errorf("query %s: %w", slug, err)
 	}
 
-	defer pr.ReadStop()
-
-	numRows := int(pr.GetNumRows())
-	const batchSize = 1000
-
-	matches := make([]int, 0)
-
-	for offset := 0; offset < numRows; offset += batchSize {
-		n := batchSize
-		if offset+n > numRows {
-			n = numRows - offset
-		}
-
-		rows := make([]Row, n)
-		if err := pr.Read(&rows); err != nil {
-			return nil, fmt.Errorf("read parquet rows: %w", err)
-		}
-
-		for _, r := range rows {
-			dbModelClean := RemovePercent(r.Model)
-			dbBackdropClean := RemovePercent(r.Backdrop)
-			dbSymbolClean := RemovePercent(r.Symbol)
+	matches := make([]Entry, 0, len(gifts))
+	for _, g := range gifts {
+		matches = append(matches, Entry{Key: key, Number: int(g.Number)})
+	}
+	return matches, nil
+}
 
-			modelMatch := dbModelClean == model
-			backdropMatch := backdrop == "" || dbBackdropClean == backdrop
-			symbolMatch := symbol == "" || dbSymbolClean == symbol
+// SearchAll searches every collection in keys at once and returns the
+// matches grouped by collection, in keys order.
+func SearchAll(keys []string, backdrop, symbol string, number int) ([]Entry, error) {
+	slugs := make([]string, len(keys))
+	names := make(map[string]string, len(keys))
+	for i, key := range keys {
+		slugs[i] = SanitizeGiftName(key)
+		names[slugs[i]] = key
+	}
+	found, err := storage.Search(context.Background(), storage.Dir, slugs, storage.Query{
+		Backdrop: backdrop,
+		Symbol:   symbol,
+		Number:   int32(number),
+	})
+	if err != nil {
+		return nil, err
+	}
 
-			if modelMatch && backdropMatch && symbolMatch {
-				matches = append(matches, int(r.Number))
-			}
+	var matches []Entry
+	for _, m := range found {
+		for _, g := range m.Gifts {
+			matches = append(matches, Entry{Key: names[m.Slug], Number: int(g.Number)})
 		}
 	}
-
 	return matches, nil
 }
@@ -22,6 +22,8 @@ func (m Model) View() string {
 		content = m.viewBackdropSelection()
 	case selectingSymbols:
 		content = m.viewSymbolsSelection()
+	case enteringNumber:
+		content = m.viewNumberInput()
 	case loadingResults:
 		content = m.viewLoading()
 		showFooter = false
@@ -34,8 +36,11 @@ func (m Model) View() string {
 	centered := centerContent(m, content)
 	if showFooter {
 		footerText := "Press q to quit. Use ↑/↓ and Enter to navigate. Ctrl+F to search."
-		if m.state == viewingResults {
+		switch m.state {
+		case viewingResults:
 			footerText = fmt.Sprintf("Page %d/%d: Use ←/→ and ↑/↓", m.page+1, m.totalPages)
+		case enteringNumber:
+			footerText = "Type a number, Enter to confirm, ⌫ to go back."
 		}
 		footer := footerView(m, footerText)
 		return centered + "\n\n" + footer
@@ -147,20 +152,24 @@ func (m Model) viewMainMenu() string {
 		}
 
 		switch i {
-		case 0:
+		case menuGift:
 			if m.SelectedKey != "" && m.SelectedValue != "" {
 				line += selectedStyle.Render(fmt.Sprintf("  ✅ %s → %s", m.SelectedKey, m.SelectedValue))
 			}
-		case 1:
+		case menuBackdrop:
 			if m.SelectedBackdrop != "" {
 				line += selectedStyle.Render(fmt.Sprintf("  ✅ %s", m.SelectedBackdrop))
 			}
-		case 2:
+		case menuSymbols:
 			if m.SelectedSymbol != "" {
 				line += selectedStyle.Render(fmt.Sprintf("  ✅ %s", m.SelectedSymbol))
 			}
-		case 3:
-			if !(m.SelectedKey != "" && m.SelectedValue != "" && (m.SelectedBackdrop != "" || m.SelectedSymbol != "")) {
+		case menuNumber:
+			if m.SelectedNumber != 0 {
+				line += selectedStyle.Render(fmt.Sprintf("  ✅ #%d", m.SelectedNumber))
+			}
+		case menuStart, menuSearchAll:
+			if !m.menuItemEnabled(i) {
 				line = disabledStyle.Render(line)
 			}
 		}
@@ -189,6 +198,9 @@ func (m Model) viewGiftSelection() string {
 		headerStyle.Render(fmt.Sprintf("🎁 %s", m.SelectedKey)),
 		lipgloss.NewStyle().Foreground(lipgloss.Color("99")).Render("📦 Select a Model (↑/↓, ⌫, Ctrl+F to search):"),
 	)
+	if supply, ok := m.supply[m.SelectedKey]; ok {
+		header += "\n" + lipgloss.NewStyle().Foreground(lipgloss.Color("245")).Render(fmt.Sprintf("📈 %s", supply))
+	}
 
 	return renderSelectionList(m.cursor, m.viewOffset, m.filteredValues, header, m.searchActive, m.searchQuery)
 }
@@ -198,9 +210,15 @@ func (m Model) viewBackdropSelection() string {
 	return renderSelectionList(m.cursor, m.viewOffset, m.filteredBackdrops, header, m.searchActive, m.searchQuery)
 }
 
-func (m Model) viewLoading() string {
+// searchLabel describes the running or finished search, e.g.
+// "Plush Pepe → Cozy Galaxy + Black" or "All gifts → Black + #1".
+func (m Model) searchLabel() string {
 	var comboParts []string
-	comboParts = append(comboParts, m.SelectedValue)
+	target := "All gifts"
+	if !m.crossSearch {
+		target = m.SelectedKey
+		comboParts = append(comboParts, m.SelectedValue)
+	}
 
 	if m.SelectedBackdrop != "" {
 		comboParts = append(comboParts, m.SelectedBackdrop)
@@ -210,9 +228,25 @@ func (m Model) viewLoading() string {
 		comboParts = append(comboParts, m.SelectedSymbol)
 	}
 
-	comboStr := strings.Join(comboParts, " + ")
+	if m.SelectedNumber != 0 {
+		comboParts = append(comboParts, fmt.Sprintf("#%d", m.SelectedNumber))
+	}
+
+	return fmt.Sprintf("%s → %s", target, strings.Join(comboParts, " + "))
+}
+
+func (m Model) viewNumberInput() string {
+	header := headerStyle.Render("🔢 Enter a Gift Number (empty for any):")
+	inputStyle := lipgloss.NewStyle().
+		Border(lipgloss.NormalBorder()).
+		BorderForeground(lipgloss.Color("205")).
+		Padding(0, 1)
+	input := inputStyle.Render(fmt.Sprintf("#%s█", m.numberInput))
+	return boxStyle.Render(header + "\n\n" + input)
+}
 
-	header := headerStyle.Render(fmt.Sprintf("🔍 Searching for: %s → %s", m.SelectedKey, comboStr))
+func (m Model) viewLoading() string {
+	header := headerStyle.Render(fmt.Sprintf("🔍 Searching for: %s", m.searchLabel()))
 	content := fmt.Sprintf("%s\n\n%s Loading...", header, m.spinner.View())
 	newBoxStyle := boxStyle
 	newBoxStyle = newBoxStyle.BorderForeground(lipgloss.Color("205"))
@@ -220,22 +254,10 @@ func (m Model) viewLoading() string {
 }
 
 func (m Model) viewResults() string {
-	var comboParts []string
-	comboParts = append(comboParts, m.SelectedValue)
-
-	if m.SelectedBackdrop != "" {
-		comboParts = append(comboParts, m.SelectedBackdrop)
-	}
-
-	if m.SelectedSymbol != "" {
-		comboParts = append(comboParts, m.SelectedSymbol)
-	}
-
-	comboStr := strings.Join(comboParts, " + ")
-
+	label := m.searchLabel()
 	header := headerStyle.Render(fmt.Sprintf(
-		"🎉 Results for: %s → %s (Page %d/%d)",
-		m.SelectedKey, comboStr, m.page+1, m.totalPages,
+		"🎉 Results for: %s (Page %d/%d)",
+		label, m.page+1, m.totalPages,
 	))
 
 	var content string
@@ -243,7 +265,7 @@ func (m Model) viewResults() string {
 	if m.error != nil {
 		content = errorStyle.Render(fmt.Sprintf("Error: %v", m.error))
 	} else if len(m.results) == 0 {
-		content = errorStyle.Render(fmt.Sprintf("No matches found for: %s", comboStr))
+		content = errorStyle.Render(fmt.Sprintf("No matches found for: %s", label))
 	} else {
 		start := m.page * viewSize
 		end := start + viewSize
@@ -251,14 +273,23 @@ func (m Model) viewResults() string {
 			end = len(m.results)
 		}
 
+		// Cross-gift results are grouped by gift; label each group where it
+		// starts on the page.
 		var links []string
 		for i, entry := range m.results[start:end] {
-			url := fmt.Sprintf("https://t.me/nft/%s-%d", utils.SanitizeGiftName(m.SelectedKey), entry)
+			if m.crossSearch && (i == 0 || m.results[start+i-1].Key != entry.Key) {
+				links = append(links, selectedStyle.Render(fmt.Sprintf("🎁 %s (%d)", entry.Key, m.groupSizes[entry.Key])))
+			}
+			url := fmt.Sprintf("https://t.me/nft/%s-%d", utils.SanitizeGiftName(entry.Key), entry.Number)
 			clickableLink := fmt.Sprintf("%d. %s", start+i+1, url)
 			links = append(links, clickableLink)
 		}
 
 		content = header + "\n\n" + strings.Join(links, "\n")
+		if m.crossSearch {
+			content += "\n\n" + lipgloss.NewStyle().Foreground(lipgloss.Color("245")).Render(
+				fmt.Sprintf("%d matches in %d gifts", len(m.results), len(m.groupSizes)))
+		}
 	}
 
 	options := []string{"Try Again", "Exit"}
@@ -7,12 +7,11 @@ import (
 	"runtime"
 )
 
-func UpdateAll() {
+func UpdateAll() error {
 	fmt.Println("Stashing changes (if any)...")
 	stashCmd := exec.Command("git", "stash", "--include-untracked")
 	if err := stashCmd.Run(); err != nil {
-		fmt.Println("Failed to stash changes:", err)
-		return
+		return fmt.Errorf("failed to stash changes: %w", err)
 	}
 
 	fmt.Println("Pulling latest changes with rebase...")
@@ -20,12 +19,12 @@ func UpdateAll() {
 	pullCmd.Stdout = os.Stdout
 	pullCmd.Stderr = os.Stderr
 	if err := pullCmd.Run(); err != nil {
-		fmt.Println("git pull --rebase failed:", err)
 		fmt.Println("You can resolve the conflict manually and then run 'git rebase --continue'")
-		return
+		return fmt.Errorf("git pull --rebase failed: %w", err)
 	}
 
 	fmt.Println("Update completed successfully.")
+	return nil
 }
 
 func ClearScreen() {
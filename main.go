@@ -1,32 +1,168 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"tg-gifts-parser/external"
-	"tg-gifts-parser/internal"
-	"tg-gifts-parser/internal/tui"
+	"tg-gifts-parser/internal/config"
+	"tg-gifts-parser/internal/parser"
+	"tg-gifts-parser/internal/progress"
+	"tg-gifts-parser/internal/storage"
+)
 
-	tea "github.com/charmbracelet/bubbletea"
+// Exit codes shared by every command, so cron jobs and CI can tell a failed
+// run from one that found problems or was interrupted.
+const (
+	exitOK          = 0
+	exitFailed      = 1
+	exitUsage       = 2
+	exitProblems    = 3
+	exitInterrupted = 130
 )
 
 func main() {
-	internal.ClearScreen()
-
-	if len(os.Args) > 1 {
-		switch os.Args[1] {
-		case "--update":
-			internal.UpdateAll()
-			internal.ClearScreen()
-		case "--external":
-			external.ScheduleUpdater()
-			return
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(argv []string) int {
+	cfg, args, err := config.Load(argv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid configuration:", err)
+		return exitUsage
+	}
+	applyConfig(cfg)
+
+	name := "tui"
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	if alias, ok := legacyModes[name]; ok {
+		fmt.Fprintf(os.Stderr, "%s is deprecated, use %q instead\n", name, strings.Join(alias, " "))
+		name, args = alias[0], append(alias[1:len(alias):len(alias)], args...)
+	}
+	switch name {
+	case "help", "-h", "-help", "--help":
+		return helpCommand(args)
+	}
+	cmd, ok := findCommand(name)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+		printUsage(os.Stderr)
+		return exitUsage
+	}
+
+	closeProgress, err := setupProgress(cfg.Progress)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to open progress log:", err)
+		return exitFailed
+	}
+	defer closeProgress()
+
+	if err := setupPageSource(cfg.Scraper); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to set up page source:", err)
+		return exitFailed
+	}
+
+	// The first SIGINT or SIGTERM cancels ctx so runs can flush what they
+	// have; a second one kills the process as usual.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	return cmd.run(ctx, cfg, cmd.flagSet(), args)
+}
+
+// finishRun prints how a run ended and picks its exit code: 130 with a
+// summary when it was interrupted, 1 when it failed.
+func finishRun(what string, count int, err error) int {
+	switch {
+	case errors.Is(err, context.Canceled):
+		fmt.Printf("%s interrupted after %d items; partial results were saved\n", what, count)
+		return exitInterrupted
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "%s failed: %v\n", what, err)
+		return exitFailed
+	}
+	return exitOK
+}
+
+// applyConfig hands the configured limits and paths to the packages that
+// use them.
+func applyConfig(cfg config.Config) {
+	parser.Workers = cfg.Scraper.Workers
+	parser.UserAgent = cfg.Scraper.UserAgent
+	parser.RetryPolicies[parser.ErrTransport] = parser.RetryPolicy{Attempts: cfg.Scraper.Attempts, Delay: cfg.Scraper.RetryDelay}
+	parser.SetRateLimit(cfg.Scraper.RateLimit, cfg.Scraper.RateBurst)
+
+	external.Workers = cfg.Updater.Workers
+	external.UpdateInterval = cfg.Updater.Interval
+	external.UpdateThreshold = cfg.Updater.Threshold
+
+	storage.Dir = cfg.Paths.Database
+	storage.Backend = cfg.Storage.Backend
+	parser.CatalogPath = cfg.Paths.Catalog
+	parser.BasePath = cfg.Paths.Base
+	parser.SupplyPath = cfg.Paths.Supply
+	external.CandidatesPath = cfg.Paths.Candidates
+	external.ChangesPath = cfg.Paths.Changes
+}
+
+// setupPageSource reads saved pages when a page directory is set. Otherwise
+// it fetches from the configured base URL, archives fetched pages when an
+// archive directory is set and spreads requests over the proxies in the
+// proxy list when there is one.
+func setupPageSource(cfg config.Scraper) error {
+	if cfg.PageDir != "" {
+		parser.SetPageSource(parser.DirSource{Dir: cfg.PageDir})
+		return nil
+	}
+	src := parser.NewHTTPSource(nil, cfg.BaseURL)
+	if cfg.Archive != "" {
+		src.Archive = &parser.Archive{Dir: cfg.Archive}
+	}
+	if path := cfg.ProxyList; path != "" {
+		urls, err := parser.LoadProxyList(path)
+		if err != nil {
+			return err
 		}
+		if src.Proxies, err = parser.NewProxyPool(urls, parser.DefaultProxyTimeout); err != nil {
+			return err
+		}
+	}
+	parser.SetPageSource(src)
+	return nil
+}
+
+// setupProgress picks the progress sinks: JSON lines on stdout instead of the
+// console text when the format is json, plus a JSON-lines copy appended to
+// the progress log when one is set.
+func setupProgress(cfg config.Progress) (func(), error) {
+	var sinks progress.Multi
+	if cfg.Format == "json" {
+		sinks = append(sinks, progress.NewJSONLines(os.Stdout))
+	} else {
+		sinks = append(sinks, progress.NewConsole(os.Stdout))
 	}
 
-	prog := tea.NewProgram(tui.InitialModel())
-	if _, err := prog.Run(); err != nil {
-		fmt.Println("TUI exited with error:", err)
+	closeLog := func() {}
+	if path := cfg.Log; path != "" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, progress.NewJSONLines(f))
+		closeLog = func() { f.Close() }
 	}
+
+	progress.SetSink(sinks)
+	return closeLog, nil
 }